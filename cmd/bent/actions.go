@@ -0,0 +1,161 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+)
+
+// An action is one toolchain command (compile, asm, link, etc.)
+// from the trace printed by "go build -x".
+type action struct {
+	Tool    string   // The tool, e.g., "compile", "asm", or "link"
+	Package string   // The package being built, if the tool was passed "-p"
+	Dir     string   // The directory in which the tool ran
+	Args    []string // The arguments that followed the tool.
+}
+
+// parseActions extracts the toolchain commands from trace, the standard
+// error of "go build -x" or "go test -x -c", a shell script.
+func parseActions(trace []byte) []action {
+	var actions []action
+	dir, heredoc := "", ""
+	sc := bufio.NewScanner(bytes.NewReader(trace))
+	sc.Buffer(nil, 1<<24) // command lines can be long
+	for sc.Scan() {
+		line := sc.Text()
+		if heredoc != "" {
+			if line == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		line = strings.TrimSuffix(line, " # internal")
+		if i := strings.Index(line, "<< '"); i >= 0 {
+			heredoc = strings.TrimSuffix(line[i+len("<< '"):], "'")
+			continue
+		}
+		words, err := shellquote.Split(line)
+		if err != nil || len(words) == 0 {
+			continue
+		}
+		// Skip any environment variable settings preceding the command.
+		for len(words) > 0 && isEnvAssignment(words[0]) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		var tool string
+		var args []string
+		switch {
+		case words[0] == "cd" && len(words) == 2:
+			dir = words[1]
+			continue
+		case words[0] == "go" && len(words) > 2 && words[1] == "tool":
+			tool, args = words[2], words[3:]
+		case strings.Contains(words[0], "/pkg/tool/"):
+			tool, args = strings.TrimSuffix(path.Base(words[0]), ".exe"), words[1:]
+		default:
+			continue
+		}
+		a := action{Tool: tool, Dir: dir, Args: args}
+		for i, arg := range args {
+			if arg == "-p" && i+1 < len(args) {
+				a.Package = args[i+1]
+				break
+			}
+		}
+		actions = append(actions, a)
+	}
+	return actions
+}
+
+// traceCommands are the shell commands, other than tools named by absolute path,
+// that "go build -x" prints.
+var traceCommands = map[string]bool{
+	"cd": true, "mkdir": true, "cat": true, "cp": true, "mv": true, "rm": true,
+	"touch": true, "ln": true, "chmod": true, "echo": true, "go": true,
+}
+
+// withoutTrace returns stderr, the standard error of a build with -x,
+// minus the shell trace, leaving any diagnostics from the go command or tools.
+func withoutTrace(stderr []byte) []byte {
+	buf := new(bytes.Buffer)
+	heredoc := ""
+	sc := bufio.NewScanner(bytes.NewReader(stderr))
+	sc.Buffer(nil, 1<<24) // command lines can be long
+	for sc.Scan() {
+		line := sc.Text()
+		if heredoc != "" {
+			if line == heredoc {
+				heredoc = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSuffix(line, " # internal")
+		if i := strings.Index(trimmed, "<< '"); i >= 0 {
+			heredoc = strings.TrimSuffix(trimmed[i+len("<< '"):], "'")
+			continue
+		}
+		if trimmed != line {
+			continue
+		}
+		words, err := shellquote.Split(line)
+		if err == nil {
+			for len(words) > 0 && isEnvAssignment(words[0]) {
+				words = words[1:]
+			}
+			if len(words) == 0 && len(line) > 0 {
+				continue // e.g., WORK=/tmp/go-build12345
+			}
+			// A diagnostic may begin with an absolute file name, followed by a colon.
+			if len(words) > 0 && (traceCommands[words[0]] || path.IsAbs(words[0]) && !strings.HasSuffix(words[0], ":")) {
+				continue
+			}
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// isEnvAssignment reports whether shell word w has the form NAME=value.
+func isEnvAssignment(w string) bool {
+	eq := strings.IndexByte(w, '=')
+	if eq <= 0 {
+		return false
+	}
+	for i, c := range w[:eq] {
+		if !(c == '_' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// recordActions writes the toolchain commands in trace, the standard error
+// of building b with -x, to <runstamp>.<config>.<bench>.actions.json.
+func (c *Configuration) recordActions(b *Benchmark, trace []byte) {
+	file := c.thingBenchName(b.Name + ".actions.json")
+	j, err := json.MarshalIndent(parseActions(trace), "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(file, j, 0664)
+	}
+	if err != nil {
+		fmt.Printf("There was an error writing %s, error %v\n", file, err)
+	}
+}
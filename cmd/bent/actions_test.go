@@ -0,0 +1,53 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sampleTrace = `WORK=/tmp/go-build2742310954
+mkdir -p $WORK/b001/
+cat >/tmp/go-build2742310954/b001/importcfg << 'EOF' # internal
+# import config
+packagefile runtime=/root/.cache/go-build/c9/c9643b-d
+EOF
+cd /tmp/xt
+/usr/local/go/pkg/tool/linux_amd64/compile -o $WORK/b001/_pkg_.a -trimpath "$WORK/b001=>" -p main -lang=go1.17 -complete -importcfg $WORK/b001/importcfg -pack ./m.go
+go tool buildid -w $WORK/b001/_pkg_.a # internal
+cp $WORK/b001/_pkg_.a /root/.cache/go-build/e6/e6d272-d # internal
+cat >/tmp/go-build2742310954/b001/importcfg.link << 'EOF' # internal
+packagefile xt=/tmp/go-build2742310954/b001/_pkg_.a
+EOF
+mkdir -p $WORK/b001/exe/
+cd .
+GOROOT='/usr/local/go' /usr/local/go/pkg/tool/linux_amd64/link -o $WORK/b001/exe/a.out -importcfg $WORK/b001/importcfg.link -buildmode=exe $WORK/b001/_pkg_.a
+`
+
+func TestParseActions(t *testing.T) {
+	got := parseActions([]byte(sampleTrace))
+	want := []action{
+		{Tool: "compile", Package: "main", Dir: "/tmp/xt",
+			Args: []string{"-o", "$WORK/b001/_pkg_.a", "-trimpath", "$WORK/b001=>", "-p", "main", "-lang=go1.17", "-complete", "-importcfg", "$WORK/b001/importcfg", "-pack", "./m.go"}},
+		{Tool: "buildid", Dir: "/tmp/xt", Args: []string{"-w", "$WORK/b001/_pkg_.a"}},
+		{Tool: "link", Dir: ".",
+			Args: []string{"-o", "$WORK/b001/exe/a.out", "-importcfg", "$WORK/b001/importcfg.link", "-buildmode=exe", "$WORK/b001/_pkg_.a"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseActions:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestWithoutTrace(t *testing.T) {
+	diagnostics := "# xt\n./m.go:3:6: warning: something concerning\n/tmp/xt/n.go:4:1: another\n"
+	got := string(withoutTrace([]byte(sampleTrace + diagnostics)))
+	if got != diagnostics {
+		t.Errorf("withoutTrace:\ngot\n%s\nwant\n%s", got, diagnostics)
+	}
+}
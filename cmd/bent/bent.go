@@ -49,8 +49,20 @@ type Benchmark struct {
 	ExtraFiles   []string // other directories expected for running tests/benchmarks
 	BuildDir     string   // Location of go.mod for this benchmark; download here, go test -c here.
 	Version      string   // To pin a benchmark at a version.
+	BuildKind    string   // "test" (the default) to build with 'go test -c', or "build" to build a program with 'go build'.
+	RunArgs      []string // Arguments for a "build" benchmark's program, which must print its own benchmark-format results.
+	// A "build" benchmark's program receives RunArgs instead of test flags, the configuration's RunFlags, and extra command-line arguments.
+	PageCache  []string // Page cache states ("cold", "warm") to run in, each run separately and labeled "pagecache: <state>".
+	CacheFiles []string // Files and directories in RunDir to read before each "warm" run.
+	Baseline   string   // A file of earlier results (relative to the bent directory) for benchstat to compare this benchmark's results with.
 }
 
+// Values for Benchmark.BuildKind.
+const (
+	buildKindTest  = "test"
+	buildKindBuild = "build"
+)
+
 type Suite struct {
 	Benchmark
 }
@@ -90,6 +102,19 @@ var wikiTable = false       // emit the tests in a form usable in a wiki table
 var explicitAll counterFlag // Include "-a" on "go test -c" test build ; repeating flag causes multiple rebuilds, useful for build benchmarking.
 var shuffle = 2             // Dimensionality of (build) shuffling; 0 = none, 1 = per-benchmark, configuration ordering, 2 = bench, config pairs, 3 = across repetitions.
 var haveRsync = true
+var dedup = false                 // share binaries between configurations whose builds are identical
+var interleave = false            // alternate configurations at every benchmark run, instead of running all of a configuration's benchmarks together
+var energy = false                // measure energy consumed by each benchmark run (Linux RAPL only)
+var buildStderr = false           // save what builds write to stderr in a per-configuration file
+var actions = false               // record the toolchain commands of each build, from -x, as JSON
+var lenientClean = false          // record build times even if "go clean -cache" failed beforehand
+var partition = false             // put each configuration's output in a bench subdirectory named for its GOOS and GOARCH
+var estimate = false              // print how long building and running will take, then exit
+var schedTrace = false            // collect execution traces of benchmark runs and report scheduler latency
+var quick = false                 // smoke test: one run, no AfterBuild or profiling, none of the extra measurements
+var suspiciousRatio = 10.0        // results of one benchmark that vary by more than this factor are suspicious; 0 = don't check
+var writeErrors = writeErrorsWarn // what to do if benchmark output cannot be written, "warn", "benchmark", or "abort"
+var benchFormat = formatCurrent   // version of the benchmark format to write, for compatibility with older benchstat
 
 //go:embed scripts/*
 var scripts embed.FS
@@ -109,6 +134,9 @@ var copyConfigs = []string{
 
 var defaultEnv []string
 
+// secretEnv holds the names of environment variables whose values must not be printed.
+var secretEnv = make(map[string]bool)
+
 type pair struct {
 	b, c int
 }
@@ -132,8 +160,13 @@ func main() {
 	var benchmarksString, configurationsString, stampLog string
 
 	flag.IntVar(&N, "N", N, "benchmark/test repeat count")
+	flag.BoolVar(&quick, "quick", quick, "smoke test configurations quickly: run once, without AfterBuild, cpuprofile/memprofile wrappers, -energy, or -trace; the results are not for comparison, so they are not compared with Baselines or added to the timing history")
 
 	flag.Var(&explicitAll, "a", "add '-a' flag to 'go test -c' to demand full recompile. Repeat or assign a value for repeat builds for benchmarking")
+	flag.BoolVar(&dedup, "dedup", dedup, "build each benchmark once for configurations that differ only in run-time settings, and share the binary")
+	flag.BoolVar(&buildStderr, "build-stderr", buildStderr, "save anything that test builds write to stderr in bench/<runstamp>.<config>.build-stderr")
+	flag.BoolVar(&actions, "actions", actions, "build with -x and write the compile, asm, link, etc. commands to bench/<runstamp>.<config>.<bench>.actions.json; tracing makes builds slower, so their times are not comparable with builds without -actions")
+	flag.BoolVar(&lenientClean, "lenient-clean", lenientClean, "record build times even when 'go clean -cache' failed first, so that the build may have been (partly) cached")
 	flag.IntVar(&shuffle, "s", shuffle, "dimensionality of (build) shuffling (0-3), 0 = none, 1 = per-benchmark, configuration ordering, 2 = bench, config pairs, 3 = across repetitions.")
 
 	flag.StringVar(&benchmarksString, "b", "", "comma-separated list of test/benchmark names (default is all)")
@@ -142,20 +175,33 @@ func main() {
 	flag.StringVar(&configurationsString, "c", "", "comma-separated list of test/benchmark configurations (default is all)")
 	flag.StringVar(&confFile, "C", confFile, "name of file describing configurations")
 
+	flag.BoolVar(&interleave, "interleave", interleave, "alternate configurations for each run of each benchmark, to minimize time-correlated bias in comparisons")
+
 	flag.BoolVar(&requireSandbox, "S", requireSandbox, "require Docker sandbox to run tests/benchmarks (& exclude unsandboxable tests/benchmarks)")
 
+	flag.BoolVar(&energy, "energy", energy, "record energy consumed by each benchmark run, from Linux RAPL counters (requires read access to /sys/class/powercap)")
+
+	flag.BoolVar(&schedTrace, "trace", schedTrace, "collect an execution trace of each (unsandboxed) benchmark run, and report its scheduler latency")
+
 	flag.BoolVar(&getOnly, "g", getOnly, "get tests/benchmarks and dependencies, do not build or run")
 	flag.StringVar(&runContainer, "r", runContainer, "skip get and build, go directly to run, using specified container (any non-empty string will do for unsandboxed execution)")
 
+	flag.BoolVar(&partition, "partition", partition, "write each configuration's output to bench/<goos>_<goarch>, according to its build target")
+
 	flag.StringVar(&stampLog, "L", stampLog, "name of log file to which runstamps are appended")
 
 	flag.BoolVar(&list, "l", list, "list available benchmarks and configurations, then exit")
+	flag.BoolVar(&estimate, "estimate", estimate, "estimate build and run time from the history in "+timingsFile+", then exit")
 	flag.BoolVar(&force, "f", force, "force run past some of the consistency checks (gopath/{pkg,bin} in particular)")
 	flag.BoolVar(&initialize, "I", initialize, "initialize a directory for running tests ((re)creates Dockerfile, (re)copies in benchmark and configuration files)")
 	flag.BoolVar(&test, "T", test, "run tests instead of benchmarks")
 
 	flag.BoolVar(&wikiTable, "W", wikiTable, "print benchmark info for a wiki table")
 
+	flag.Float64Var(&suspiciousRatio, "suspicious-ratio", suspiciousRatio, "after running, report results where one benchmark's values vary by more than this factor as suspicious (0 = don't); zero times and negative values are always reported")
+	flag.StringVar(&writeErrors, "write-errors", writeErrors, "what to do when output cannot be written or synced: \""+writeErrorsWarn+"\" and continue, stop running the affected \""+writeErrorsBench+"\", or \""+writeErrorsAbort+"\" the whole run")
+	flag.StringVar(&benchFormat, "format", benchFormat, "benchmark format version to write, \""+formatCurrent+"\" (with Unit metadata lines) or \""+formatLegacy+"\" (for older benchstat)")
+
 	flag.Var(&verbose, "v", "print commands and other information (more -v = print more details)")
 
 	flag.Usage = func() {
@@ -197,12 +243,26 @@ results will also appear in 'bench'.
 
 	flag.Parse()
 
+	if quick {
+		fmt.Println("Warning: -quick results are a smoke test, not suitable for comparisons")
+		N = 1
+		energy = false
+		schedTrace = false
+	}
+
 	_, errRsync := exec.LookPath("rsync")
 	if errRsync != nil {
 		haveRsync = false
 		fmt.Println("Warning: using cp instead of rsync")
 	}
 
+	if energy {
+		if _, err := readEnergy(); err != nil {
+			fmt.Printf("Warning: not recording energy, error reading RAPL counters: %v\n", err)
+			energy = false
+		}
+	}
+
 	if requireSandbox {
 		_, errDocker := exec.LookPath("docker")
 		if errDocker != nil {
@@ -280,6 +340,8 @@ results will also appear in 'bench'.
 		update(&b.Version, s.Version)
 		update(&b.Tests, s.Tests)
 		update(&b.Benchmarks, s.Benchmarks)
+		update(&b.BuildKind, s.BuildKind)
+		update(&b.Baseline, s.Baseline)
 
 		b.Disabled = s.Disabled || b.Disabled
 		b.NotSandboxed = s.NotSandboxed || b.NotSandboxed
@@ -287,6 +349,9 @@ results will also appear in 'bench'.
 		updateFlags(&b.ExtraFiles, s.ExtraFiles)
 		updateFlags(&b.BuildFlags, s.BuildFlags)
 		updateFlags(&b.GcEnv, s.GcEnv)
+		updateFlags(&b.RunArgs, s.RunArgs)
+		updateFlags(&b.PageCache, s.PageCache)
+		updateFlags(&b.CacheFiles, s.CacheFiles)
 
 	}
 
@@ -345,13 +410,21 @@ results will also appear in 'bench'.
 		for j, s := range trial.RunEnv {
 			trial.RunEnv[j] = os.ExpandEnv(s)
 		}
+		for _, s := range trial.SecretEnv {
+			secretEnv[s] = true
+		}
 		todo.Configurations[i].GcFlags = os.ExpandEnv(trial.GcFlags)
+		todo.Configurations[i].RunContainer = os.ExpandEnv(trial.RunContainer)
 		for j, s := range trial.RunFlags {
 			trial.RunFlags[j] = os.ExpandEnv(s)
 		}
 		for j, s := range trial.RunWrapper {
 			trial.RunWrapper[j] = os.ExpandEnv(s)
 		}
+		if quick {
+			todo.Configurations[i].AfterBuild = nil
+			todo.Configurations[i].RunWrapper = withoutProfiler(trial.RunWrapper)
+		}
 	}
 	for b, v := range configurations {
 		if v {
@@ -382,6 +455,9 @@ results will also appear in 'bench'.
 		for j, s := range bench.GcEnv {
 			bench.GcEnv[j] = os.ExpandEnv(s)
 		}
+		if quick {
+			todo.Benchmarks[i].RunWrapper = withoutProfiler(bench.RunWrapper)
+		}
 		// Trim possible trailing slash, do not want
 		if '/' == bench.Repo[len(bench.Repo)-1] {
 			bench.Repo = bench.Repo[:len(bench.Repo)-1]
@@ -390,6 +466,25 @@ results will also appear in 'bench'.
 		if "" == bench.Version {
 			todo.Benchmarks[i].Version = "@latest"
 		}
+		switch bench.BuildKind {
+		case "":
+			todo.Benchmarks[i].BuildKind = buildKindTest
+		case buildKindTest:
+		case buildKindBuild:
+			if test {
+				fmt.Printf("Disabling %s because it is a program, not a test\n", bench.Name)
+				todo.Benchmarks[i].Disabled = true
+			}
+		default:
+			fmt.Printf("Benchmark %s has BuildKind %q, which ought to be %q or %q\n", bench.Name, bench.BuildKind, buildKindTest, buildKindBuild)
+			os.Exit(1)
+		}
+		for _, cache := range bench.PageCache {
+			if cache != pageCacheCold && cache != pageCacheWarm {
+				fmt.Printf("Benchmark %s has PageCache %q, which ought to be %q or %q\n", bench.Name, cache, pageCacheCold, pageCacheWarm)
+				os.Exit(1)
+			}
+		}
 		if "" == bench.Tests || !test {
 			if !test {
 				todo.Benchmarks[i].Tests = "none"
@@ -426,9 +521,15 @@ results will also appear in 'bench'.
 
 	// If more verbose, print the normalized configuration.
 	if verbose > 1 {
+		shown := *todo
+		shown.Configurations = make([]Configuration, len(todo.Configurations))
+		for i, c := range todo.Configurations {
+			c.RunEnv = maskSecrets(c.RunEnv)
+			shown.Configurations[i] = c
+		}
 		buf := new(bytes.Buffer)
-		if err := toml.NewEncoder(buf).Encode(todo); err != nil {
-			fmt.Printf("There was an error encoding %v: %v\n", todo, err)
+		if err := toml.NewEncoder(buf).Encode(&shown); err != nil {
+			fmt.Printf("There was an error encoding %v: %v\n", &shown, err)
 			os.Exit(1)
 		}
 		fmt.Println(buf.String())
@@ -457,7 +558,7 @@ results will also appear in 'bench'.
 		return
 	}
 
-	if stampLog != "" {
+	if stampLog != "" && !estimate {
 		f, err := os.OpenFile(stampLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.ModePerm)
 		if err != nil {
 			fmt.Printf("There was an error opening %s for output, error %v\n", stampLog, err)
@@ -481,6 +582,45 @@ results will also appear in 'bench'.
 	defaultEnv = replaceEnv(defaultEnv, "GOARCH", runtime.GOARCH)
 	defaultEnv = ifMissingAddEnv(defaultEnv, "GO111MODULE", "auto")
 
+	// Running binaries that use instructions this machine lacks crashes with SIGILL, so don't.
+	for i := range todo.Configurations {
+		config := &todo.Configurations[i]
+		if config.Disabled {
+			continue
+		}
+		if missing := config.missingCPUFeatures(nil); len(missing) > 0 {
+			fmt.Printf("Disabling configuration %s because this machine lacks required CPU features: %s\n", config.Name, strings.Join(missing, ", "))
+			config.Disabled = true
+		}
+	}
+
+	// It is possible to request repeated builds for compiler/linker benchmarking.
+	// Normal (non-negative build count) varies configuration most frequently,
+	// then benchmark, then repeats the process N times (innerBuildCount = 1).
+	// If build count is negative, the configuration varies least frequently,
+	// and each benchmark is built buildCount (innerBuildCount) times before
+	// moving on to the next. (This tends to focus intermittent benchmarking
+	// noise on single configuration-benchmark combos.  This is the "old way".
+	buildCount := int(explicitAll)
+	if buildCount < 0 {
+		buildCount = -buildCount
+	}
+	if buildCount == 0 {
+		buildCount = 1
+	}
+
+	loadTimings()
+
+	if estimate {
+		if dedup {
+			shareBuilds(todo.Configurations)
+		}
+		printEstimate(todo, buildCount)
+		return
+	}
+
+	checkPageCache(todo)
+
 	var needSandbox bool    // true if any benchmark needs a sandbox
 	var needNotSandbox bool // true if any benchmark needs to be not sandboxed
 
@@ -490,6 +630,10 @@ results will also appear in 'bench'.
 
 	for i, config := range todo.Configurations {
 		if !config.Disabled { // Don't overwrite if something was disabled.
+			if err := mkdirAsNeeded(config.benchDir()); err != nil {
+				fmt.Println(err)
+				os.Exit(2)
+			}
 			s := config.thingBenchName("stdout")
 			f, err := os.OpenFile(s, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 			if err != nil {
@@ -497,24 +641,18 @@ results will also appear in 'bench'.
 				os.Exit(2)
 			}
 			todo.Configurations[i].benchWriter = f
+			if quick {
+				todo.Configurations[i].say(metadataLine("bent-mode", "quick"))
+			}
+			if energy {
+				todo.Configurations[i].createEnergyFile()
+			}
+			if schedTrace {
+				todo.Configurations[i].createSchedFiles()
+			}
 		}
 	}
 
-	// It is possible to request repeated builds for compiler/linker benchmarking.
-	// Normal (non-negative build count) varies configuration most frequently,
-	// then benchmark, then repeats the process N times (innerBuildCount = 1).
-	// If build count is negative, the configuration varies least frequently,
-	// and each benchmark is built buildCount (innerBuildCount) times before
-	// moving on to the next. (This tends to focus intermittent benchmarking
-	// noise on single configuration-benchmark combos.  This is the "old way".
-	buildCount := int(explicitAll)
-	if buildCount < 0 {
-		buildCount = -buildCount
-	}
-	if buildCount == 0 {
-		buildCount = 1
-	}
-
 	for i := range todo.Benchmarks {
 		bench := &todo.Benchmarks[i]
 
@@ -527,6 +665,10 @@ results will also appear in 'bench'.
 		bench.BuildDir = path.Join(dirs.build, bench.Name)
 	}
 
+	if dedup {
+		shareBuilds(todo.Configurations)
+	}
+
 	if runContainer == "" { // If not reusing binaries/container...
 		if verbose == 0 {
 			fmt.Print("Go getting")
@@ -613,7 +755,7 @@ results will also appear in 'bench'.
 
 		// First for each configuration, get the compiler and library and install it in its own GOROOT.
 		for ci, config := range todo.Configurations {
-			if config.Disabled {
+			if config.Disabled || config.buildsFrom != "" {
 				continue
 			}
 
@@ -695,6 +837,20 @@ results will also appear in 'bench'.
 			}
 		}
 
+		// Configurations sharing a build cannot run if the configuration doing the build failed.
+		for ci := range todo.Configurations {
+			config := &todo.Configurations[ci]
+			if config.Disabled || config.buildsFrom == "" {
+				continue
+			}
+			for _, other := range todo.Configurations {
+				if other.Name == config.buildsFrom && other.Disabled {
+					fmt.Printf("Disabling configuration %s because %s, whose build it shares, is disabled\n", config.Name, other.Name)
+					config.Disabled = true
+				}
+			}
+		}
+
 		if verbose == 0 {
 			fmt.Print("\nCompiling")
 		}
@@ -707,7 +863,7 @@ results will also appear in 'bench'.
 						continue
 					}
 					for ci, config := range todo.Configurations {
-						if config.Disabled {
+						if config.Disabled || config.buildsFrom != "" {
 							continue
 						}
 						s := todo.Configurations[ci].compileOne(&todo.Benchmarks[bi], dirs.wd, yyy)
@@ -733,7 +889,7 @@ results will also appear in 'bench'.
 
 					for ci := range todo.Configurations {
 						config := &todo.Configurations[permute[ci]]
-						if config.Disabled {
+						if config.Disabled || config.buildsFrom != "" {
 							continue
 						}
 						s := config.compileOne(&todo.Benchmarks[bi], dirs.wd, yyy)
@@ -758,7 +914,7 @@ results will also appear in 'bench'.
 				for _, p := range permute {
 					bench := &todo.Benchmarks[p.b]
 					config := &todo.Configurations[p.c]
-					if bench.Disabled || config.Disabled {
+					if bench.Disabled || config.Disabled || config.buildsFrom != "" {
 						continue
 					}
 					s := config.compileOne(bench, dirs.wd, yyy)
@@ -784,7 +940,7 @@ results will also appear in 'bench'.
 			for _, p := range permute {
 				bench := &todo.Benchmarks[p.b]
 				config := &todo.Configurations[p.c]
-				if bench.Disabled || config.Disabled {
+				if bench.Disabled || config.Disabled || config.buildsFrom != "" {
 					continue
 				}
 				s := config.compileOne(bench, dirs.wd, p.k)
@@ -916,10 +1072,28 @@ benchmarks_loop:
 		copy("testdata", false)
 	}
 
+	// Find the images for configurations that run in containers.
+	for i := range todo.Configurations {
+		config := &todo.Configurations[i]
+		if config.Disabled || config.RunContainer == "" {
+			continue
+		}
+		if err := config.inspectRunContainer(); err != nil {
+			s := fmt.Sprintf("Could not use RunContainer %s, error %v", config.RunContainer, err)
+			fmt.Println(s + "\nDISABLING configuration " + config.Name)
+			getAndBuildFailures = append(getAndBuildFailures, s+"("+config.Name+")\n")
+			config.Disabled = true
+			continue
+		}
+		config.say(metadataLine("runcontainer", config.runContainerID))
+	}
+
 	var failures []string
+	var suspicious []string // Implausible results, which may indicate a broken benchmark
 
 	// If there's a bad error running one of the benchmarks, report what we've got, please.
-	defer func(t *Todo) {
+	// os.Exit skips deferred calls, so exiting with an error code must call summarize itself.
+	summarize := func() {
 		for _, config := range todo.Configurations {
 			if !config.Disabled { // Don't overwrite if something was disabled.
 				config.benchWriter.Close()
@@ -941,123 +1115,167 @@ benchmarks_loop:
 				fmt.Println(f)
 			}
 		}
-	}(todo)
-
-	maxrc := 0
-
-	// N repetitions for each configurationm, run all the benchmarks.
-	// TODO randomize the benchmarks and configurations, like for builds.
-	for i := 0; i < N; i++ {
-		// For each configuration, run all the benchmarks.
-		for j, config := range todo.Configurations {
-			if config.Disabled {
-				continue
+		if len(suspicious) > 0 {
+			fmt.Println("Suspicious results:")
+			for _, s := range suspicious {
+				fmt.Println(s)
 			}
+		}
+	}
+	defer summarize()
 
-			for _, b := range todo.Benchmarks {
-				if b.Disabled {
-					continue
-				}
+	maxrc := 0
 
-				root := config.Root
+	// runInCache runs benchmark b's binary for configuration j, for repetition i,
+	// first putting the page cache in the requested state, if any.
+	runInCache := func(i, j int, b Benchmark, cache string) {
+		config := &todo.Configurations[j]
+		testBinaryName := config.binaryName(&b)
 
-				wrapperPrefix := "/"
-				if b.NotSandboxed {
-					wrapperPrefix = dirs.wd + "/"
-				}
-				wrapperFor := func(s []string) string {
-					x := ""
-					if len(s) > 0 {
-						// If not an explicit path, then make it an explicit path
-						x = s[0]
-						if x[0] != '/' {
-							x = wrapperPrefix + x
-						}
-					}
-					return x
-				}
+		// A test binary is told what to run with test flags; a plain program gets its own arguments.
+		benchArgs := b.RunArgs
+		if b.BuildKind != buildKindBuild {
+			benchArgs = []string{"-test.run=" + b.Tests, "-test.bench=" + b.Benchmarks}
+			benchArgs = append(benchArgs, config.RunFlags...)
+			benchArgs = append(benchArgs, moreArgs...)
+		}
 
-				configWrapper := wrapperFor(config.RunWrapper)
-				benchWrapper := wrapperFor(b.RunWrapper)
+		// Execution traces are written where bent can read them only if the
+		// binary does not run in the sandbox.
+		traceFile := ""
+		if schedTrace && b.BuildKind != buildKindBuild && (b.NotSandboxed || config.RunContainer != "") {
+			traceFile = config.traceFile(testBinaryName, i, cache)
+			benchArgs = append(benchArgs, "-test.trace="+traceFile)
+		}
 
-				testBinaryName := config.benchName(&b)
-				var s string
-				var rc int
+		cmd := config.runCmd(&b, i, benchArgs, container)
+		s, rc := config.runBench(&b, cmd, cache, traceFile)
+		if s != "" {
+			fmt.Println(s)
+			failures = append(failures, s)
+		}
+		if rc > maxrc {
+			maxrc = rc
+		}
+	}
 
-				var wrappersAndBin []string
+	// runOne runs benchmark b's binary for configuration j, for repetition i,
+	// once for each page cache state that b requests.
+	runOne := func(i, j int, b Benchmark) {
+		if len(b.PageCache) == 0 {
+			runInCache(i, j, b, "")
+			return
+		}
+		for _, cache := range b.PageCache {
+			runInCache(i, j, b, cache)
+		}
+	}
 
-				if configWrapper != "" {
-					wrappersAndBin = append(wrappersAndBin, configWrapper)
-					wrappersAndBin = append(wrappersAndBin, config.RunWrapper[1:]...)
-				}
-				if benchWrapper != "" {
-					wrappersAndBin = append(wrappersAndBin, benchWrapper)
-					wrappersAndBin = append(wrappersAndBin, b.RunWrapper[1:]...)
+	if interleave {
+		// N repetitions, for each benchmark, run each configuration once.
+		// The configuration order reverses on alternate repetitions so that
+		// no configuration always runs first or last.
+		for i := 0; i < N && !writeAborted; i++ {
+			for _, b := range todo.Benchmarks {
+				if b.Disabled {
+					continue
 				}
-
-				if b.NotSandboxed {
-					bin := path.Join(dirs.wd, dirs.testBinDir, testBinaryName)
-					wrappersAndBin = append(wrappersAndBin, bin)
-
-					cmd := exec.Command(wrappersAndBin[0], wrappersAndBin[1:]...)
-					cmd.Args = append(cmd.Args, "-test.run="+b.Tests)
-					cmd.Args = append(cmd.Args, "-test.bench="+b.Benchmarks)
-
-					cmd.Dir = b.RunDir
-					cmd.Env = defaultEnv
-					if root != "" {
-						cmd.Env = replaceEnv(cmd.Env, "GOROOT", root)
+				for k := range todo.Configurations {
+					j := k
+					if i%2 == 1 {
+						j = len(todo.Configurations) - 1 - k
 					}
-					cmd.Env = replaceEnvs(cmd.Env, config.RunEnv)
-					cmd.Env = append(cmd.Env, "BENT_DIR="+dirs.wd)
-					cmd.Env = append(cmd.Env, "BENT_PROFILES="+path.Join(dirs.wd, config.thingBenchName("profiles")))
-					cmd.Env = append(cmd.Env, "BENT_BINARY="+testBinaryName)
-					cmd.Env = append(cmd.Env, "BENT_I="+strconv.FormatInt(int64(i), 10))
-					cmd.Args = append(cmd.Args, config.RunFlags...)
-					cmd.Args = append(cmd.Args, moreArgs...)
-
-					config.say("shortname: " + b.Name + "\n")
-					config.say("toolchain: " + config.Name + "\n")
-					s, rc = todo.Configurations[j].runBinary(dirs.wd, cmd, false)
-				} else {
-					// docker run --net=none -e GOROOT=... -w /src/github.com/minio/minio/cmd $D /testbin/cmd_Config.test -test.short -test.run=Nope -test.v -test.bench=Benchmark'(Get|Put|List)'
-					// TODO(jfaller): I don't think we need either of these "/" below, investigate...
-					bin := "/" + path.Join(dirs.testBinDir, testBinaryName)
-					wrappersAndBin = append(wrappersAndBin, bin)
-
-					cmd := exec.Command("docker", "run", "--net=none", "-w", b.RunDir)
-					for _, e := range config.RunEnv {
-						cmd.Args = append(cmd.Args, "-e", e)
+					if todo.Configurations[j].Disabled {
+						continue
 					}
-					cmd.Args = append(cmd.Args, "-e", "BENT_DIR=/") // TODO this is not going to work well
-					cmd.Args = append(cmd.Args, "-e", "BENT_PROFILES="+path.Join(dirs.wd, config.thingBenchName("profiles")))
-					cmd.Args = append(cmd.Args, "-e", "BENT_BINARY="+testBinaryName)
-					cmd.Args = append(cmd.Args, "-e", "BENT_I="+strconv.FormatInt(int64(i), 10))
-					cmd.Args = append(cmd.Args, container)
-					cmd.Args = append(cmd.Args, wrappersAndBin...)
-					cmd.Args = append(cmd.Args, "-test.run="+b.Tests)
-					cmd.Args = append(cmd.Args, "-test.bench="+b.Benchmarks)
-					cmd.Args = append(cmd.Args, config.RunFlags...)
-					cmd.Args = append(cmd.Args, moreArgs...)
-					config.say("shortname: " + b.Name + "\n")
-					config.say("toolchain: " + config.Name + "\n")
-					s, rc = todo.Configurations[j].runBinary(dirs.wd, cmd, false)
+					runOne(i, j, b)
 				}
-				if s != "" {
-					fmt.Println(s)
-					failures = append(failures, s)
+			}
+		}
+	} else {
+		// N repetitions for each configurationm, run all the benchmarks.
+		// TODO randomize the benchmarks and configurations, like for builds.
+		for i := 0; i < N && !writeAborted; i++ {
+			// For each configuration, run all the benchmarks.
+			for j, config := range todo.Configurations {
+				if config.Disabled {
+					continue
 				}
-				if rc > maxrc {
-					maxrc = rc
+
+				for _, b := range todo.Benchmarks {
+					if b.Disabled {
+						continue
+					}
+					runOne(i, j, b)
 				}
 			}
 		}
 	}
+	if writeAborted {
+		summarize()
+		os.Exit(2)
+	}
+	if !quick { // One run tells too little about how long runs take.
+		saveTimings()
+	}
+	for i := range todo.Configurations {
+		if !todo.Configurations[i].Disabled {
+			todo.Configurations[i].writeInfo(todo)
+			suspicious = append(suspicious, todo.Configurations[i].checkResults(suspiciousRatio)...)
+		}
+	}
+	for i := range todo.Configurations {
+		config := &todo.Configurations[i]
+		if config.Disabled || quick {
+			continue
+		}
+		for j := range todo.Benchmarks {
+			if b := &todo.Benchmarks[j]; !b.Disabled && b.Baseline != "" {
+				config.compareBaseline(b)
+			}
+		}
+	}
+	if quick {
+		fmt.Println("Warning: these were -quick results, a smoke test, not suitable for comparisons")
+	}
 	if maxrc > 0 {
+		summarize()
 		os.Exit(maxrc)
 	}
 }
 
+// withoutProfiler returns wrapper, unless it is one of the profiling
+// wrappers (cpuprofile or memprofile), which -quick omits.
+func withoutProfiler(wrapper []string) []string {
+	if len(wrapper) > 0 {
+		if w := path.Base(wrapper[0]); w == "cpuprofile" || w == "memprofile" {
+			return nil
+		}
+	}
+	return wrapper
+}
+
+// shareBuilds arranges for each enabled configuration whose build hash matches
+// that of an earlier enabled configuration to run that configuration's binaries
+// instead of building its own.
+func shareBuilds(configs []Configuration) {
+	builder := make(map[string]string)
+	for i := range configs {
+		c := &configs[i]
+		c.buildsFrom = ""
+		if c.Disabled {
+			continue
+		}
+		h := c.buildHash()
+		if name, ok := builder[h]; ok {
+			c.buildsFrom = name
+			fmt.Printf("Configuration %s builds identically to %s, sharing its binaries\n", c.Name, name)
+			continue
+		}
+		builder[h] = c.Name
+	}
+}
+
 func escape(s string) string {
 	s = strings.Replace(s, "\\", "\\\\", -1)
 	s = strings.Replace(s, "'", "\\'", -1)
@@ -1081,16 +1299,34 @@ func asCommandLine(cwd string, cmd *exec.Cmd) string {
 			!strings.HasPrefix(e, "HOME=") &&
 			!strings.HasPrefix(e, "USER=") &&
 			!strings.HasPrefix(e, "SHELL=") {
-			s += escape(e)
+			s += escape(maskSecret(e))
 		}
 	}
 	for _, a := range cmd.Args {
-		s += escape(a)
+		s += escape(maskSecret(a))
 	}
 	s += " )"
 	return s
 }
 
+// maskSecret returns s, except that if s assigns a value to a secret
+// environment variable, the value is replaced with "***".
+func maskSecret(s string) string {
+	if eq := strings.IndexByte(s, '='); eq > 0 && secretEnv[s[:eq]] {
+		return s[:eq+1] + "***"
+	}
+	return s
+}
+
+// maskSecrets returns a copy of env with maskSecret applied to each element.
+func maskSecrets(env []string) []string {
+	var masked []string
+	for _, e := range env {
+		masked = append(masked, maskSecret(e))
+	}
+	return masked
+}
+
 // checkAndSetUpFileSystem does a number of tasks to ensure that the tests will
 // run properly. It:
 //
@@ -1113,6 +1349,18 @@ func checkAndSetUpFileSystem(shouldInit bool) error {
 		return fmt.Errorf("Shuffle value (-s) ought to be between 0 and 3, inclusive, instead is %d\n", shuffle)
 	}
 
+	if benchFormat != formatCurrent && benchFormat != formatLegacy {
+		return fmt.Errorf("Benchmark format (-format) ought to be %s or %s, instead is %s\n", formatCurrent, formatLegacy, benchFormat)
+	}
+
+	if writeErrors != writeErrorsWarn && writeErrors != writeErrorsBench && writeErrors != writeErrorsAbort {
+		return fmt.Errorf("Write error handling (-write-errors) ought to be %s, %s, or %s, instead is %s\n", writeErrorsWarn, writeErrorsBench, writeErrorsAbort, writeErrors)
+	}
+
+	if suspiciousRatio != 0 && !(suspiciousRatio >= 1) {
+		return fmt.Errorf("Suspicious result ratio (-suspicious-ratio) ought to be 0 (no check) or at least 1, instead is %v\n", suspiciousRatio)
+	}
+
 	// Initialize the directory, copying in default benchmarks and sample configurations, and creating a Dockerfile
 	if shouldInit {
 		if perr == nil {
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -72,3 +73,20 @@ func TestBent(t *testing.T) {
 	}
 
 }
+
+func TestAsCommandLineMasksSecrets(t *testing.T) {
+	defer func(m map[string]bool) { secretEnv = m }(secretEnv)
+	secretEnv = map[string]bool{"API_TOKEN": true}
+
+	cmd := exec.Command("docker", "run", "-e", "API_TOKEN=hunter2", "-e", "GOGC=100", "image")
+	cmd.Env = []string{"API_TOKEN=hunter2", "GOMAXPROCS=4"}
+	line := asCommandLine("", cmd)
+	if strings.Contains(line, "hunter2") {
+		t.Errorf("asCommandLine leaked a secret: %s", line)
+	}
+	for _, want := range []string{"API_TOKEN=***", "GOGC=100", "GOMAXPROCS=4"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("asCommandLine output %s lacks %s", line, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+var warnedNoBenchstat = false
+
+// benchResults returns the lines of stdout, the contents of a configuration's
+// stdout file, that belong in a results file for the benchmark with short name name.
+// Those are all the configuration lines and other text, but only the result lines
+// that follow a "shortname: name" line, and not those of other benchmarks.
+func benchResults(stdout []byte, name string) []byte {
+	buf := new(bytes.Buffer)
+	shortname := ""
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "shortname:") {
+			shortname = strings.TrimSpace(strings.TrimPrefix(line, "shortname:"))
+		} else if strings.HasPrefix(line, "Benchmark") && shortname != name {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// compareBaseline writes b's results for c to <runstamp>.<config>.<bench>.results
+// and, if benchstat is installed, compares them with b's Baseline,
+// writing the comparison to <runstamp>.<config>.<bench>.compare.
+func (c *Configuration) compareBaseline(b *Benchmark) {
+	stdout, err := ioutil.ReadFile(c.thingBenchName("stdout"))
+	if err != nil {
+		fmt.Printf("There was an error reading the results of %s, error %v\n", c.benchName(b), err)
+		return
+	}
+	results := c.thingBenchName(b.Name + ".results")
+	if err := ioutil.WriteFile(results, benchResults(stdout, b.Name), 0664); err != nil {
+		fmt.Printf("There was an error writing %s, error %v\n", results, err)
+		return
+	}
+
+	benchstat, err := exec.LookPath("benchstat")
+	if err != nil {
+		if !warnedNoBenchstat {
+			fmt.Printf("Not comparing results with their Baselines because benchstat is not installed; the results are in %s and friends\n", results)
+			warnedNoBenchstat = true
+		}
+		return
+	}
+	baseline := b.Baseline
+	if !path.IsAbs(baseline) {
+		baseline = path.Join(dirs.wd, baseline)
+	}
+	cmd := exec.Command(benchstat, baseline, results)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		fmt.Printf("There was an error running %s, error %v\n%s", asCommandLine(dirs.wd, cmd), err, out)
+		return
+	}
+	compare := c.thingBenchName(b.Name + ".compare")
+	if err := ioutil.WriteFile(compare, out, 0664); err != nil {
+		fmt.Printf("There was an error writing %s, error %v\n", compare, err)
+		return
+	}
+	fmt.Printf("%s compared with %s:\n%s", c.benchName(b), b.Baseline, out)
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"testing"
+)
+
+const sampleStdout = `goos: linux
+goarch: amd64
+shortname: crypto
+toolchain: Go
+pkg: crypto/sha256
+BenchmarkHash8Bytes-8 	 5000000	       250 ns/op
+PASS
+shortname: json
+toolchain: Go
+BenchmarkCodeEncoder-8 	     500	   2500000 ns/op
+PASS
+shortname: crypto
+toolchain: Go
+BenchmarkHash8Bytes-8 	 5000000	       251 ns/op
+PASS
+`
+
+func TestBenchResults(t *testing.T) {
+	got := string(benchResults([]byte(sampleStdout), "crypto"))
+	want := `goos: linux
+goarch: amd64
+shortname: crypto
+toolchain: Go
+pkg: crypto/sha256
+BenchmarkHash8Bytes-8 	 5000000	       250 ns/op
+PASS
+shortname: json
+toolchain: Go
+PASS
+shortname: crypto
+toolchain: Go
+BenchmarkHash8Bytes-8 	 5000000	       251 ns/op
+PASS
+`
+	if got != want {
+		t.Errorf("benchResults:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
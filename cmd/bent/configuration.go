@@ -10,12 +10,14 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,23 +27,68 @@ import (
 // initiate a bent run. These structures are read from a .toml file at
 // boot-time.
 type Configuration struct {
-	Name        string   // Short name used for binary names, mention on command line
-	Root        string   // Specific Go root to use for this trial
-	BuildFlags  []string // BuildFlags supplied to 'go test -c' for building (e.g., "-p 1")
-	AfterBuild  []string // Array of commands to run, output of all commands for a configuration (across binaries) is collected in <runstamp>.<config>.<cmd>
-	GcFlags     string   // GcFlags supplied to 'go test -c' for building
-	GcEnv       []string // Environment variables supplied to 'go test -c' for building
-	RunFlags    []string // Extra flags passed to the test binary
-	RunEnv      []string // Extra environment variables passed to the test binary
-	RunWrapper  []string // (Outermost) Command and args to precede whatever the operation is; may fail in the sandbox.
-	Disabled    bool     // True if this configuration is temporarily disabled
-	buildStats  []BenchStat
-	benchWriter *os.File
-	rootCopy    string // The contents of GOROOT are copied here to allow benchmarking of just the test compilation.
+	Name             string   // Short name used for binary names, mention on command line
+	Root             string   // Specific Go root to use for this trial
+	BuildFlags       []string // BuildFlags supplied to 'go test -c' for building (e.g., "-p 1")
+	AfterBuild       []string // Array of commands to run, output of all commands for a configuration (across binaries) is collected in <runstamp>.<config>.<cmd>
+	GcFlags          string   // GcFlags supplied to 'go test -c' for building
+	GcEnv            []string // Environment variables supplied to 'go test -c' for building
+	RunFlags         []string // Extra flags passed to the test binary
+	RunEnv           []string // Extra environment variables passed to the test binary
+	SecretEnv        []string // Names of RunEnv variables whose values are secret and are masked whenever bent prints them
+	RunWrapper       []string // (Outermost) Command and args to precede whatever the operation is; may fail in the sandbox.
+	RunContainer     string   // If not empty, an image in which to run the binaries (which must be built for linux), using Docker or Podman.
+	CPUFeatures      []string // CPU features (e.g., "avx2") that this configuration's binaries require, in addition to any implied by GOAMD64 in GcEnv
+	Disabled         bool     // True if this configuration is temporarily disabled
+	buildStats       []BenchStat
+	benchWriter      *os.File
+	rootCopy         string               // The contents of GOROOT are copied here to allow benchmarking of just the test compilation.
+	buildsFrom       string               // If not empty, the name of an earlier configuration with an identical build whose binaries this one runs.
+	pageCacheLabeled bool                 // True once a "pagecache" label has been written to benchWriter.
+	runCounts        map[string]*runCount // Indexed by benchmark name
+	runContainerID   string               // The image digest (or, lacking one, ID) of RunContainer
+	writeFailed      bool                 // True if output could not be written since the last call to writeFailedFor, with -write-errors=benchmark.
+	writeFailures    map[string]bool      // Indexed by benchmark name, true if its output could not be written.
 }
 
 var dirs *directories // constant across all configurations, useful in other contexts.
 
+// runCount is the number of runs of one benchmark for a configuration.
+type runCount struct {
+	ok, failed int
+}
+
+// Versions of the benchmark format that bent can write.
+const (
+	formatLegacy  = "legacy"  // configuration and result lines only
+	formatCurrent = "current" // also describes result units with "Unit" metadata lines
+)
+
+// writeAborted is set when output could not be written with -write-errors=abort;
+// after that, nothing more is built or run, and bent exits once it has summarized the failures.
+var writeAborted = false
+
+// What to do when benchmark output cannot be written or synced.
+const (
+	writeErrorsWarn  = "warn"      // report the error and carry on
+	writeErrorsBench = "benchmark" // report the error and stop running the affected benchmark for that configuration
+	writeErrorsAbort = "abort"     // report the error and stop the whole run
+)
+
+// metadataLine returns a benchmark-format configuration line assigning value to key.
+func metadataLine(key, value string) string {
+	return key + ": " + value + "\n"
+}
+
+// unitLine returns a benchmark-format line attaching metadata (key=value pairs) to unit,
+// or the empty string if the format being written predates unit metadata.
+func unitLine(unit string, metadata ...string) string {
+	if benchFormat == formatLegacy {
+		return ""
+	}
+	return "Unit " + unit + " " + strings.Join(metadata, " ") + "\n"
+}
+
 func (c *Configuration) buildBenchName() string {
 	return c.thingBenchName("build")
 }
@@ -50,13 +97,63 @@ func (c *Configuration) thingBenchName(suffix string) string {
 	if len(suffix) != 0 {
 		suffix = path.Base(suffix)
 	}
-	return path.Join(dirs.benchDir, runstamp+"."+c.Name+"."+suffix)
+	return path.Join(c.benchDir(), runstamp+"."+c.Name+"."+suffix)
+}
+
+// benchDir returns the directory for c's benchmark output files,
+// which with -partition is a subdirectory named for c's build target.
+func (c *Configuration) benchDir() string {
+	if !partition {
+		return dirs.benchDir
+	}
+	goos, goarch := c.buildTarget()
+	return path.Join(dirs.benchDir, goos+"_"+goarch)
+}
+
+// buildTarget returns the GOOS and GOARCH that c's binaries are built for.
+// Sandboxed (-S) binaries are all built for linux.
+func (c *Configuration) buildTarget() (goos, goarch string) {
+	env := replaceEnvs(defaultEnv, c.GcEnv)
+	goos, goarch = getenv(env, "GOOS"), getenv(env, "GOARCH")
+	if requireSandbox {
+		goos = "linux"
+	}
+	return goos, goarch
 }
 
 func (c *Configuration) benchName(b *Benchmark) string {
 	return b.Name + "_" + c.Name
 }
 
+// binaryName returns the name of the test binary that c runs for b,
+// which belongs to another configuration if c shares that configuration's builds.
+func (c *Configuration) binaryName(b *Benchmark) string {
+	if c.buildsFrom != "" {
+		return b.Name + "_" + c.buildsFrom
+	}
+	return c.benchName(b)
+}
+
+// buildHash returns a key that is the same for any two configurations
+// whose builds of a benchmark are identical.  It must include every
+// configuration field that affects either the goroot build or compileOne;
+// AfterBuild is included too, since it runs as part of the build.
+func (c *Configuration) buildHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "Root=%q\n", c.Root)
+	fmt.Fprintf(h, "GcFlags=%q\n", c.GcFlags)
+	for _, f := range c.BuildFlags {
+		fmt.Fprintf(h, "BuildFlags=%q\n", f)
+	}
+	for _, e := range c.GcEnv {
+		fmt.Fprintf(h, "GcEnv=%q\n", e)
+	}
+	for _, a := range c.AfterBuild {
+		fmt.Fprintf(h, "AfterBuild=%q\n", a)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 func (c *Configuration) goCommand() string {
 	gocmd := "go"
 	if c.Root != "" {
@@ -74,7 +171,7 @@ func (c *Configuration) goCommandCopy() string {
 }
 
 func (config *Configuration) createFilesForLater() {
-	if config.Disabled {
+	if config.Disabled || config.buildsFrom != "" {
 		return
 	}
 	f, err := os.Create(config.buildBenchName())
@@ -82,11 +179,24 @@ func (config *Configuration) createFilesForLater() {
 		fmt.Println("Error creating build benchmark file ", config.buildBenchName(), ", err=", err)
 		config.Disabled = true
 	} else {
-		fmt.Fprintf(f, "goos: %s\n", runtime.GOOS)
-		fmt.Fprintf(f, "goarch: %s\n", runtime.GOARCH)
+		header := metadataLine("goos", runtime.GOOS) + metadataLine("goarch", runtime.GOARCH)
+		// Build times are measurements, not exact values; say so explicitly.
+		for _, unit := range []string{"build-real-ns/op", "build-user-ns/op", "build-sys-ns/op"} {
+			header += unitLine(unit, "assume=nothing")
+		}
+		config.writeHeader(f, header)
 		f.Close() // will be appending later
 	}
 
+	if buildStderr {
+		f, err := os.Create(config.buildStderrName())
+		if err != nil {
+			fmt.Println("Error creating build stderr file ", config.buildStderrName(), ", err=", err)
+		} else {
+			f.Close() // will be appending later
+		}
+	}
+
 	for _, cmd := range config.AfterBuild {
 		tbn := config.thingBenchName(cmd)
 		f, err := os.Create(tbn)
@@ -99,26 +209,49 @@ func (config *Configuration) createFilesForLater() {
 	}
 }
 
+func (c *Configuration) energyBenchName() string {
+	return c.thingBenchName("energy")
+}
+
+// createEnergyFile creates the file to which recordEnergy appends.
+func (c *Configuration) createEnergyFile() {
+	f, err := os.Create(c.energyBenchName())
+	if err != nil {
+		fmt.Println("Error creating energy benchmark file ", c.energyBenchName(), ", err=", err)
+		return
+	}
+	c.writeHeader(f, metadataLine("goos", runtime.GOOS)+metadataLine("goarch", runtime.GOARCH)+unitLine("energy-joules/op", "assume=nothing"))
+	f.Close() // will be appending later
+}
+
+// recordEnergy appends the energy consumed by one run of b's binary to c's energy file.
+// This is the energy of all the processor packages during the whole run,
+// including process startup and anything else running on the machine.
+func (c *Configuration) recordEnergy(b *Benchmark, joules float64) {
+	s := fmt.Sprintf("Benchmark%s 1 %.3f energy-joules/op\n", strings.Title(b.Name), joules)
+	if verbose > 0 {
+		fmt.Print(s)
+	}
+	f, err := os.OpenFile(c.energyBenchName(), os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		fmt.Printf("There was an error opening %s for append, error %v\n", c.energyBenchName(), err)
+		return
+	}
+	c.writeOutput(f, []byte(s))
+	f.Close()
+}
+
 func (config *Configuration) runOtherBenchmarks(b *Benchmark, cwd string) {
 	// Run various other "benchmark" commands on the built binaries, e.g., size, quality of debugging information.
-	if config.Disabled {
+	if config.Disabled || b.Disabled {
 		return
 	}
 
 	for _, cmd := range config.AfterBuild {
 		tbn := config.thingBenchName(cmd)
-		f, err := os.OpenFile(tbn, os.O_WRONLY|os.O_APPEND, os.ModePerm)
-		if err != nil {
-			fmt.Printf("There was an error opening %s for append, error %v\n", tbn, err)
-			continue
-		}
-
 		if !strings.ContainsAny(cmd, "/") {
 			cmd = path.Join(cwd, cmd)
 		}
-		if b.Disabled {
-			continue
-		}
 		testBinaryName := config.benchName(b)
 		c := exec.Command(cmd, path.Join(cwd, dirs.testBinDir, testBinaryName), b.Name)
 
@@ -143,17 +276,34 @@ func (config *Configuration) runOtherBenchmarks(b *Benchmark, cwd string) {
 			fmt.Printf("Error running %s\n", cmd)
 			continue
 		}
-		f.Write(output)
-		f.Sync()
+		f, err := os.OpenFile(tbn, os.O_WRONLY|os.O_APPEND, os.ModePerm)
+		if err != nil {
+			fmt.Printf("There was an error opening %s for append, error %v\n", tbn, err)
+			continue
+		}
+		config.writeOutput(f, output)
 		f.Close()
 	}
 }
 
 func (config *Configuration) compileOne(bench *Benchmark, cwd string, count int) string {
+	if config.Disabled || bench.Disabled || writeAborted {
+		return "" // Not even a cache clean; nothing further happens with this pair.
+	}
+	// A benchmark's own GcEnv (e.g., GOAMD64) can demand more of the machine than the configuration does.
+	if missing := config.missingCPUFeatures(bench); len(missing) > 0 {
+		s := fmt.Sprintf("Not building %s because this machine lacks required CPU features: %s", config.benchName(bench), strings.Join(missing, ", "))
+		if count != 0 {
+			return "" // Reported the first time.
+		}
+		fmt.Println(s)
+		return s + "(" + bench.Name + ")\n"
+	}
 	root := config.rootCopy
 	gocmd := config.goCommandCopy()
 	gopath := path.Join(cwd, "gopath")
 
+	cleanFailed := false
 	if explicitAll != 1 { // clear cache unless "-a[=1]" which requests -a on compilation.
 		cmd := exec.Command(gocmd, "clean", "-cache")
 		cmd.Env = defaultEnv
@@ -169,10 +319,16 @@ func (config *Configuration) compileOne(bench *Benchmark, cwd string, count int)
 		s, _ := config.runBinary("", cmd, true)
 		if s != "" {
 			fmt.Println("Error running go clean -cache, ", s)
+			cleanFailed = true
 		}
 	}
 
-	cmd := exec.Command(gocmd, "test", "-vet=off", "-c")
+	var cmd *exec.Cmd
+	if bench.BuildKind == buildKindBuild {
+		cmd = exec.Command(gocmd, "build")
+	} else {
+		cmd = exec.Command(gocmd, "test", "-vet=off", "-c")
+	}
 	compileTo := path.Join(dirs.wd, dirs.testBinDir, config.benchName(bench))
 	cmd.Args = append(cmd.Args, "-o", compileTo)
 	cmd.Args = append(cmd.Args, bench.BuildFlags...)
@@ -185,6 +341,9 @@ func (config *Configuration) compileOne(bench *Benchmark, cwd string, count int)
 	if config.GcFlags != "" {
 		cmd.Args = append(cmd.Args, "-gcflags="+config.GcFlags)
 	}
+	if actions {
+		cmd.Args = append(cmd.Args, "-x")
+	}
 	cmd.Args = append(cmd.Args, bench.Repo)
 	cmd.Dir = bench.BuildDir // use module-mode
 	cmd.Env = defaultEnv
@@ -205,36 +364,88 @@ func (config *Configuration) compileOne(bench *Benchmark, cwd string, count int)
 
 	defer cleanup(gopath)
 
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
 	start := time.Now()
-	output, err := cmd.CombinedOutput()
+	err := cmd.Run()
 	realTime := time.Since(start)
+	// With -actions, stderr is mostly the -x trace; keep that out of the diagnostics.
+	diagnostics := stderr.Bytes()
+	if actions {
+		diagnostics = withoutTrace(diagnostics)
+	}
+	if buildStderr {
+		config.recordBuildStderr(bench, diagnostics)
+	}
+	if actions {
+		config.recordActions(bench, stderr.Bytes())
+	}
 	if err != nil {
 		s := ""
 		switch e := err.(type) {
 		case *exec.ExitError:
-			s = fmt.Sprintf("There was an error running 'go test', output = %s", output)
+			s = fmt.Sprintf("There was an error running 'go %s', stdout = %s, stderr = %s", cmd.Args[1], stdout, diagnostics)
 		default:
-			s = fmt.Sprintf("There was an error running 'go test', output = %s, error = %v", output, e)
+			s = fmt.Sprintf("There was an error running 'go %s', stdout = %s, stderr = %s, error = %v", cmd.Args[1], stdout, diagnostics, e)
 		}
 		fmt.Println(s + "DISABLING benchmark " + bench.Name)
 		bench.Disabled = true // if it won't compile, it won't run, either.
 		return s + "(" + bench.Name + ")\n"
 	}
-	soutput := string(output)
+	// A build that might have used the cache is not a trustworthy measurement.
+	untimed := ""
+	if cleanFailed && !lenientClean {
+		untimed = fmt.Sprintf("Not recording the build time of %s because go clean -cache failed", config.benchName(bench))
+		fmt.Println(untimed)
+		untimed += "(" + bench.Name + ")\n"
+	} else {
+		config.recordBuild(bench, realTime, cmd.ProcessState, gopath)
+	}
+
+	// Trim /usr/bin/time info from stderr, it's ugly
+	if verbose > 0 {
+		fmt.Print(stdout.String())
+		serr := string(diagnostics)
+		i := strings.LastIndex(serr, "real")
+		if i >= 0 {
+			serr = serr[:i]
+		}
+		if serr != "" {
+			fmt.Printf("stderr from building %s:\n%s", config.benchName(bench), serr)
+		}
+	}
+
+	// Do this here before any cleanup.
+	if count == 0 {
+		config.runOtherBenchmarks(bench, cwd)
+	}
+	if config.writeFailedFor(bench) {
+		s := fmt.Sprintf("Could not write the build output of %s, not running it", config.benchName(bench))
+		fmt.Println(s)
+		untimed += s + "(" + bench.Name + ")\n"
+	}
+
+	return untimed
+}
+
+// recordBuild records the time taken to build bench, described by realTime and ps,
+// in config's build benchmark file.
+func (config *Configuration) recordBuild(bench *Benchmark, realTime time.Duration, ps *os.ProcessState, gopath string) {
 	bs := BenchStat{
 		Name:     bench.Name,
 		RealTime: realTime,
-		UserTime: cmd.ProcessState.UserTime(),
-		SysTime:  cmd.ProcessState.SystemTime(),
+		UserTime: ps.UserTime(),
+		SysTime:  ps.SystemTime(),
 	}
 	config.buildStats = append(config.buildStats, bs)
+	history.recordBuild(config.benchName(bench), realTime)
 
 	// Report and record build stats to testbin
 
 	buf := new(bytes.Buffer)
 	configGoArch := getenv(config.GcEnv, "GOARCH")
 	if configGoArch != runtime.GOARCH && configGoArch != "" {
-		s := fmt.Sprintf("goarch: %s-%s\n", runtime.GOARCH, configGoArch)
+		s := metadataLine("goarch", runtime.GOARCH+"-"+configGoArch)
 		if verbose > 0 {
 			fmt.Print(s)
 		}
@@ -252,36 +463,238 @@ func (config *Configuration) compileOne(bench *Benchmark, cwd string, count int)
 		cleanup(gopath)
 		os.Exit(2)
 	}
-	f.Write(buf.Bytes())
-	f.Sync()
+	config.writeOutput(f, buf.Bytes())
 	f.Close()
+}
 
-	// Trim /usr/bin/time info from soutput, it's ugly
-	if verbose > 0 {
-		i := strings.LastIndex(soutput, "real")
-		if i >= 0 {
-			soutput = soutput[:i]
+func (c *Configuration) buildStderrName() string {
+	return c.thingBenchName("build-stderr")
+}
+
+// recordBuildStderr appends whatever building b wrote to stderr, if anything, to c's build-stderr file.
+func (c *Configuration) recordBuildStderr(b *Benchmark, stderr []byte) {
+	if len(stderr) == 0 {
+		return
+	}
+	f, err := os.OpenFile(c.buildStderrName(), os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		fmt.Printf("There was an error opening %s for append, error %v\n", c.buildStderrName(), err)
+		return
+	}
+	c.writeOutput(f, append([]byte("# "+c.benchName(b)+"\n"), stderr...))
+	f.Close()
+}
+
+// writeOutput writes b to f and syncs it, handling any error as -write-errors directs.
+// It returns false if b could not be written.
+func (c *Configuration) writeOutput(f *os.File, b []byte) bool {
+	nw, err := f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		return true
+	}
+	fmt.Printf("Error writing %s, err = %v, nwritten = %d, nrequested = %d\n", f.Name(), err, nw, len(b))
+	switch writeErrors {
+	case writeErrorsAbort:
+		if !writeAborted {
+			fmt.Printf("Stopping the run because output could not be written (-write-errors=%s)\n", writeErrors)
 		}
-		fmt.Print(soutput)
+		writeAborted = true
+	case writeErrorsBench:
+		c.writeFailed = true
 	}
+	return false
+}
 
-	// Do this here before any cleanup.
-	if count == 0 {
-		config.runOtherBenchmarks(bench, cwd)
+// writeHeader writes header, the lines that begin one of c's output files, to f.
+// If that fails with -write-errors=benchmark, all of c's benchmarks are affected, so c is disabled.
+func (c *Configuration) writeHeader(f *os.File, header string) {
+	if c.writeOutput(f, []byte(header)) || writeErrors != writeErrorsBench {
+		return
 	}
+	c.writeFailed = false
+	fmt.Printf("DISABLING configuration %s because the start of %s could not be written\n", c.Name, f.Name())
+	c.Disabled = true
+}
 
-	return ""
+// writeFailedFor reports whether b's output for c could not be written, either
+// since the previous call (in which case that is remembered) or earlier.
+func (c *Configuration) writeFailedFor(b *Benchmark) bool {
+	if c.writeFailed {
+		c.writeFailed = false
+		if c.writeFailures == nil {
+			c.writeFailures = make(map[string]bool)
+		}
+		c.writeFailures[b.Name] = true
+	}
+	return c.writeFailures[b.Name]
 }
 
 // say writes s to c's benchmark output file
 func (c *Configuration) say(s string) {
-	b := []byte(s)
-	nw, err := c.benchWriter.Write(b)
-	if err != nil {
-		fmt.Printf("Error writing, err = %v, nwritten = %d, nrequested = %d\n", err, nw, len(b))
+	c.writeOutput(c.benchWriter, []byte(s))
+	fmt.Print(s)
+}
+
+// runCmd returns the command that runs b's binary for c, for repetition i,
+// passing it benchArgs. The binary runs in c's RunContainer if it has one,
+// else directly if b is not sandboxed, else in the sandbox container.
+func (c *Configuration) runCmd(b *Benchmark, i int, benchArgs []string, container string) *exec.Cmd {
+	root := c.Root
+
+	wrapperPrefix := "/"
+	if b.NotSandboxed || c.RunContainer != "" {
+		wrapperPrefix = dirs.wd + "/"
+	}
+	wrapperFor := func(s []string) string {
+		x := ""
+		if len(s) > 0 {
+			// If not an explicit path, then make it an explicit path
+			x = s[0]
+			if x[0] != '/' {
+				x = wrapperPrefix + x
+			}
+		}
+		return x
+	}
+
+	configWrapper := wrapperFor(c.RunWrapper)
+	benchWrapper := wrapperFor(b.RunWrapper)
+
+	testBinaryName := c.binaryName(b)
+
+	var wrappersAndBin []string
+
+	if configWrapper != "" {
+		wrappersAndBin = append(wrappersAndBin, configWrapper)
+		wrappersAndBin = append(wrappersAndBin, c.RunWrapper[1:]...)
+	}
+	if benchWrapper != "" {
+		wrappersAndBin = append(wrappersAndBin, benchWrapper)
+		wrappersAndBin = append(wrappersAndBin, b.RunWrapper[1:]...)
+	}
+
+	var cmd *exec.Cmd
+	if c.RunContainer != "" {
+		// The working directory is mounted at the same path in the container,
+		// which makes the binary, wrappers, and run directory all available.
+		bin := path.Join(dirs.wd, dirs.testBinDir, testBinaryName)
+		wrappersAndBin = append(wrappersAndBin, bin)
+
+		cmd = exec.Command(containerEngine, "run", "--rm", "--net=none", "-v", dirs.wd+":"+dirs.wd, "-w", b.RunDir)
+		for _, e := range c.RunEnv {
+			cmd.Args = append(cmd.Args, "-e", e)
+		}
+		cmd.Args = append(cmd.Args, "-e", "BENT_DIR="+dirs.wd)
+		cmd.Args = append(cmd.Args, "-e", "BENT_PROFILES="+path.Join(dirs.wd, c.thingBenchName("profiles")))
+		cmd.Args = append(cmd.Args, "-e", "BENT_BINARY="+testBinaryName)
+		cmd.Args = append(cmd.Args, "-e", "BENT_I="+strconv.FormatInt(int64(i), 10))
+		cmd.Args = append(cmd.Args, c.RunContainer)
+		cmd.Args = append(cmd.Args, wrappersAndBin...)
+		cmd.Args = append(cmd.Args, benchArgs...)
+	} else if b.NotSandboxed {
+		bin := path.Join(dirs.wd, dirs.testBinDir, testBinaryName)
+		wrappersAndBin = append(wrappersAndBin, bin)
+
+		cmd = exec.Command(wrappersAndBin[0], wrappersAndBin[1:]...)
+		cmd.Args = append(cmd.Args, benchArgs...)
+
+		cmd.Dir = b.RunDir
+		cmd.Env = defaultEnv
+		if root != "" {
+			cmd.Env = replaceEnv(cmd.Env, "GOROOT", root)
+		}
+		cmd.Env = replaceEnvs(cmd.Env, c.RunEnv)
+		cmd.Env = append(cmd.Env, "BENT_DIR="+dirs.wd)
+		cmd.Env = append(cmd.Env, "BENT_PROFILES="+path.Join(dirs.wd, c.thingBenchName("profiles")))
+		cmd.Env = append(cmd.Env, "BENT_BINARY="+testBinaryName)
+		cmd.Env = append(cmd.Env, "BENT_I="+strconv.FormatInt(int64(i), 10))
+	} else {
+		// docker run --net=none -e GOROOT=... -w /src/github.com/minio/minio/cmd $D /testbin/cmd_Config.test -test.short -test.run=Nope -test.v -test.bench=Benchmark'(Get|Put|List)'
+		// TODO(jfaller): I don't think we need either of these "/" below, investigate...
+		bin := "/" + path.Join(dirs.testBinDir, testBinaryName)
+		wrappersAndBin = append(wrappersAndBin, bin)
+
+		cmd = exec.Command("docker", "run", "--net=none", "-w", b.RunDir)
+		for _, e := range c.RunEnv {
+			cmd.Args = append(cmd.Args, "-e", e)
+		}
+		cmd.Args = append(cmd.Args, "-e", "BENT_DIR=/") // TODO this is not going to work well
+		cmd.Args = append(cmd.Args, "-e", "BENT_PROFILES="+path.Join(dirs.wd, c.thingBenchName("profiles")))
+		cmd.Args = append(cmd.Args, "-e", "BENT_BINARY="+testBinaryName)
+		cmd.Args = append(cmd.Args, "-e", "BENT_I="+strconv.FormatInt(int64(i), 10))
+		cmd.Args = append(cmd.Args, container)
+		cmd.Args = append(cmd.Args, wrappersAndBin...)
+		cmd.Args = append(cmd.Args, benchArgs...)
+	}
+	return cmd
+}
+
+// runBench runs cmd, which runs b's binary for c, in page cache state cache (if any).
+// It labels the run in c's output, and records how long it took, and any energy
+// and (if traceFile is not empty) scheduler latency measurements.
+// Like runBinary, it returns an error string and the exit code if the run fails.
+// If c's output for b could not be written (with -write-errors=benchmark),
+// it does not run b; the first time, it returns an error string saying so.
+func (c *Configuration) runBench(b *Benchmark, cmd *exec.Cmd, cache, traceFile string) (string, int) {
+	if writeAborted || c.writeFailedFor(b) {
+		return "", 0 // Already reported.
+	}
+	if len(c.missingCPUFeatures(b)) > 0 {
+		return "", 0 // Reported when not building it.
+	}
+	if cache != "" {
+		if err := preparePageCache(cache, b); err != nil {
+			return fmt.Sprintf("Skipping %s page cache run of %s: %v", cache, c.binaryName(b), err), 0
+		}
+	}
+	notRun := func() string {
+		return fmt.Sprintf("Could not write the output of %s for %s, not running it again", c.binaryName(b), c.Name)
+	}
+
+	c.say(metadataLine("shortname", b.Name))
+	c.say(metadataLine("toolchain", c.Name))
+	if cache != "" {
+		c.pageCacheLabeled = true
+		c.say(metadataLine("pagecache", cache))
+	} else if c.pageCacheLabeled {
+		// Don't let the previous label apply to this benchmark.
+		c.say(metadataLine("pagecache", "unmanaged"))
+	}
+	if writeAborted {
+		return "", 0
+	}
+	if c.writeFailedFor(b) {
+		// Unlabeled results would be worse than none.
+		c.countRun(b, false)
+		return notRun(), 0
+	}
+
+	var energyStart energySample
+	var energyErr error
+	if energy {
+		energyStart, energyErr = readEnergy()
+	}
+	start := time.Now()
+	s, rc := c.runBinary(dirs.wd, cmd, false)
+	if s == "" {
+		history.recordRun(c.benchName(b), time.Since(start))
+	}
+	if energy && energyErr == nil {
+		if energyEnd, err := readEnergy(); err == nil {
+			c.recordEnergy(b, energyEnd.joulesSince(energyStart))
+		}
+	}
+	if traceFile != "" && s == "" {
+		c.recordSchedLatency(b, traceFile)
+	}
+	if s == "" && c.writeFailedFor(b) {
+		s = notRun()
 	}
-	c.benchWriter.Sync()
-	fmt.Print(string(b))
+	c.countRun(b, s == "")
+	return s, rc
 }
 
 // runBinary runs cmd and displays the output.
@@ -319,11 +732,9 @@ func (c *Configuration) runBinary(cwd string, cmd *exec.Cmd, printWorkingDot boo
 			n := len(bytes)
 			if n > 0 {
 				mu.Lock()
-				nw, err := c.benchWriter.Write(bytes[0:n])
-				if err != nil {
-					fmt.Printf("Error writing, err = %v, nwritten = %d, nrequested = %d\n", err, nw, n)
+				if !c.writeOutput(c.benchWriter, bytes[0:n]) && writeAborted {
+					cmd.Process.Kill() // Don't leave it running after bent exits.
 				}
-				c.benchWriter.Sync()
 				fmt.Print(string(bytes[0:n]))
 				mu.Unlock()
 			}
@@ -0,0 +1,310 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildHash(t *testing.T) {
+	base := Configuration{Name: "Base", Root: "/go/", GcFlags: "-N", GcEnv: []string{"GOAMD64=v3"}}
+
+	same := base
+	same.Name = "Same"
+	same.RunEnv = []string{"GOGC=200"}
+	same.RunFlags = []string{"-test.short"}
+	same.RunWrapper = []string{"cpuprofile"}
+	if base.buildHash() != same.buildHash() {
+		t.Errorf("configurations differing only in run settings have different build hashes")
+	}
+
+	different := []Configuration{
+		{Root: "/other/", GcFlags: "-N", GcEnv: []string{"GOAMD64=v3"}},
+		{Root: "/go/", GcFlags: "-l", GcEnv: []string{"GOAMD64=v3"}},
+		{Root: "/go/", GcFlags: "-N", GcEnv: []string{"GOAMD64=v1"}},
+		{Root: "/go/", GcFlags: "-N", GcEnv: []string{"GOAMD64=v3"}, BuildFlags: []string{"-tags", "purego"}},
+		{Root: "/go/", GcFlags: "-N", GcEnv: []string{"GOAMD64=v3"}, AfterBuild: []string{"benchsize"}},
+	}
+	for _, c := range different {
+		if base.buildHash() == c.buildHash() {
+			t.Errorf("configuration %+v has the same build hash as %+v", c, base)
+		}
+	}
+}
+
+func TestShareBuilds(t *testing.T) {
+	configs := []Configuration{
+		{Name: "A", Root: "/go/", RunEnv: []string{"GOGC=100"}},
+		{Name: "B", Root: "/go/", RunEnv: []string{"GOGC=200"}},
+		{Name: "C", Root: "/tip/"},
+		{Name: "D", Root: "/tip/", Disabled: true},
+		{Name: "E", Root: "/tip/", RunFlags: []string{"-test.short"}},
+	}
+	shareBuilds(configs)
+	want := []string{"", "A", "", "", "C"}
+	for i, c := range configs {
+		if c.buildsFrom != want[i] {
+			t.Errorf("configuration %s shares builds of %q, want %q", c.Name, c.buildsFrom, want[i])
+		}
+	}
+	b := &Benchmark{Name: "uuid"}
+	if got := configs[1].binaryName(b); got != "uuid_A" {
+		t.Errorf("binaryName = %s, want uuid_A", got)
+	}
+}
+
+func TestRequiredCPUFeatures(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("GOAMD64 levels only apply on amd64")
+	}
+	defer func(env []string) { defaultEnv = env }(defaultEnv)
+	defaultEnv = []string{"GOARCH=amd64"}
+
+	has := func(features []string, f string) bool {
+		for _, g := range features {
+			if g == f {
+				return true
+			}
+		}
+		return false
+	}
+
+	v3 := Configuration{GcEnv: []string{"GOAMD64=v3"}, CPUFeatures: []string{"aes"}}
+	req := v3.requiredCPUFeatures(nil)
+	for _, f := range []string{"aes", "popcnt", "avx2", "fma"} {
+		if !has(req, f) {
+			t.Errorf("GOAMD64=v3 requirements %v lack %s", req, f)
+		}
+	}
+	if has(req, "avx512f") {
+		t.Errorf("GOAMD64=v3 requirements %v include avx512f", req)
+	}
+
+	if req := (&Configuration{}).requiredCPUFeatures(nil); len(req) != 0 {
+		t.Errorf("default configuration requires %v", req)
+	}
+	cross := Configuration{GcEnv: []string{"GOARCH=arm64", "GOAMD64=v4"}}
+	if req := cross.requiredCPUFeatures(nil); len(req) != 0 {
+		t.Errorf("cross-compiled configuration requires %v", req)
+	}
+
+	// A benchmark's GOAMD64 counts, unless the configuration overrides it.
+	bench := &Benchmark{Name: "b", GcEnv: []string{"GOAMD64=v3"}}
+	if req := (&Configuration{}).requiredCPUFeatures(bench); !has(req, "avx2") {
+		t.Errorf("requirements %v for a GOAMD64=v3 benchmark lack avx2", req)
+	}
+	v1 := Configuration{GcEnv: []string{"GOAMD64=v1"}}
+	if req := v1.requiredCPUFeatures(bench); has(req, "avx2") {
+		t.Errorf("GOAMD64=v1 configuration's requirements %v for a GOAMD64=v3 benchmark include avx2", req)
+	}
+}
+
+// setUpDisabledTest creates, in a temporary directory, the directories that
+// building and running use, and an executable script that records that it ran.
+// It returns the temporary directory and the files the script creates.
+func setUpDisabledTest(t *testing.T) (tmp, script, marker string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+	tmp = t.TempDir()
+	saveDirs, saveEnv := dirs, defaultEnv
+	t.Cleanup(func() { dirs, defaultEnv = saveDirs, saveEnv })
+	dirs = &directories{wd: tmp, gopath: path.Join(tmp, "gopath"), testBinDir: "testbin", benchDir: path.Join(tmp, "bench")}
+	defaultEnv = os.Environ()
+	for _, d := range []string{path.Join(tmp, "gopath", "bin"), path.Join(tmp, "testbin"), dirs.benchDir, path.Join(tmp, "goroot", "bin")} {
+		if err := os.MkdirAll(d, 0775); err != nil {
+			t.Fatal(err)
+		}
+	}
+	marker = path.Join(tmp, "marker")
+	script = path.Join(tmp, "record")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+marker+"\necho \"$@\"\n"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// listDir returns the names of the files in d.
+func listDir(t *testing.T, d string) []string {
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestDisabledBenchmarkSkipsAfterBuild(t *testing.T) {
+	tmp, script, marker := setUpDisabledTest(t)
+	config := &Configuration{Name: "Tip", AfterBuild: []string{script}}
+	b := &Benchmark{Name: "uuid", NotSandboxed: true, Disabled: true}
+
+	config.runOtherBenchmarks(b, tmp)
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("AfterBuild command ran for a disabled benchmark")
+	}
+	if files := listDir(t, dirs.benchDir); len(files) != 0 {
+		t.Errorf("disabled benchmark created files %v", files)
+	}
+
+	// Make sure the test would notice the work if it happened.
+	config.createFilesForLater()
+	b.Disabled = false
+	config.runOtherBenchmarks(b, tmp)
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("AfterBuild command did not run for an enabled benchmark")
+	}
+	if out, _ := os.ReadFile(config.thingBenchName(script)); len(out) == 0 {
+		t.Errorf("AfterBuild output was not recorded for an enabled benchmark")
+	}
+}
+
+func TestDisabledBenchmarkSkipsBuild(t *testing.T) {
+	tmp, script, marker := setUpDisabledTest(t)
+	gocmd := path.Join(tmp, "goroot", "bin", "go")
+	if err := os.Symlink(script, gocmd); err != nil {
+		t.Fatal(err)
+	}
+	config := &Configuration{Name: "Tip", AfterBuild: []string{script}, rootCopy: path.Join(tmp, "goroot")}
+	b := &Benchmark{Name: "uuid", Repo: "github.com/google/uuid", NotSandboxed: true, BuildDir: tmp, Disabled: true}
+
+	for _, count := range []int{0, 1} {
+		if s := config.compileOne(b, tmp, count); s != "" {
+			t.Errorf("compileOne of a disabled benchmark failed: %s", s)
+		}
+	}
+	if out, err := os.ReadFile(marker); err == nil {
+		t.Errorf("building a disabled benchmark ran commands:\n%s", out)
+	}
+	if files := listDir(t, path.Join(tmp, "testbin")); len(files) != 0 {
+		t.Errorf("building a disabled benchmark created binaries %v", files)
+	}
+	if files := listDir(t, dirs.benchDir); len(files) != 0 {
+		t.Errorf("building a disabled benchmark created files %v", files)
+	}
+	if _, err := os.Stat(path.Join(tmp, "gopath", "bin")); err != nil {
+		t.Errorf("building a disabled benchmark cleaned up gopath/bin")
+	}
+}
+
+func TestWriteFailedFor(t *testing.T) {
+	defer func(w string) { writeErrors = w }(writeErrors)
+	writeErrors = writeErrorsBench
+
+	f, err := os.Create(path.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close() // so that writes fail
+
+	config := &Configuration{Name: "c"}
+	b1, b2 := &Benchmark{Name: "b1"}, &Benchmark{Name: "b2"}
+	if config.writeOutput(f, []byte("x\n")) {
+		t.Fatal("writeOutput to a closed file succeeded")
+	}
+	if !config.writeFailedFor(b1) {
+		t.Errorf("writeFailedFor(b1) = false after a failed write")
+	}
+	if config.writeFailedFor(b2) {
+		t.Errorf("writeFailedFor(b2) = true, but only b1's output failed")
+	}
+	if !config.writeFailedFor(b1) {
+		t.Errorf("writeFailedFor(b1) forgot the earlier failure")
+	}
+}
+
+func TestRunCmdRunContainer(t *testing.T) {
+	saveDirs, saveEngine, saveSecrets := dirs, containerEngine, secretEnv
+	defer func() { dirs, containerEngine, secretEnv = saveDirs, saveEngine, saveSecrets }()
+	dirs = &directories{wd: "/work", testBinDir: "testbin", benchDir: "/work/bench"}
+	containerEngine = "podman"
+	secretEnv = map[string]bool{"API_TOKEN": true}
+
+	config := &Configuration{Name: "Tip", RunContainer: "golang:1.17", RunEnv: []string{"API_TOKEN=hunter2", "GOGC=200"}, RunWrapper: []string{"tmpclr"}}
+	b := &Benchmark{Name: "json", RunDir: "/work/gopath/src/json"}
+	cmd := config.runCmd(b, 3, []string{"-test.bench=Benchmark"}, "unused")
+
+	profiles := path.Join("/work", config.thingBenchName("profiles"))
+	want := []string{"podman", "run", "--rm", "--net=none", "-v", "/work:/work", "-w", "/work/gopath/src/json",
+		"-e", "API_TOKEN=hunter2", "-e", "GOGC=200",
+		"-e", "BENT_DIR=/work", "-e", "BENT_PROFILES=" + profiles, "-e", "BENT_BINARY=json_Tip", "-e", "BENT_I=3",
+		"golang:1.17", "/work/tmpclr", "/work/testbin/json_Tip", "-test.bench=Benchmark"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("runCmd:\ngot  %q\nwant %q", cmd.Args, want)
+	}
+	if cmd.Dir != "" || cmd.Env != nil {
+		t.Errorf("runCmd set Dir %q, Env %q for a command that runs in a container", cmd.Dir, cmd.Env)
+	}
+	line := asCommandLine(dirs.wd, cmd)
+	if strings.Contains(line, "hunter2") || !strings.Contains(line, "API_TOKEN=***") {
+		t.Errorf("asCommandLine did not mask the secret: %s", line)
+	}
+}
+
+func TestFailedSaySkipsRun(t *testing.T) {
+	defer func(w string) { writeErrors = w }(writeErrors)
+	writeErrors = writeErrorsBench
+	tmp, script, marker := setUpDisabledTest(t)
+
+	f, err := os.Create(path.Join(tmp, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close() // so that labeling the run fails
+	config := &Configuration{Name: "Tip", benchWriter: f}
+	b := &Benchmark{Name: "json"}
+
+	if s, _ := config.runBench(b, exec.Command(script, "first"), "", ""); s == "" {
+		t.Errorf("runBench reported no error when its output could not be written")
+	}
+	if s, _ := config.runBench(b, exec.Command(script, "second"), "", ""); s != "" {
+		t.Errorf("runBench reported an error again: %s", s)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("runBench ran the benchmark even though its output could not be written")
+	}
+	if rc := config.runCounts[b.Name]; rc == nil || rc.ok != 0 || rc.failed != 1 {
+		t.Errorf("runBench counted runs %+v, want 1 failed", rc)
+	}
+}
+
+func TestWriteAbortStopsRun(t *testing.T) {
+	defer func(w string, a bool) { writeErrors, writeAborted = w, a }(writeErrors, writeAborted)
+	writeErrors, writeAborted = writeErrorsAbort, false
+	tmp, _, _ := setUpDisabledTest(t)
+
+	f, err := os.Create(path.Join(tmp, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close() // so that writing the benchmark's output fails
+	config := &Configuration{Name: "Tip", benchWriter: f}
+
+	start := time.Now()
+	config.runBinary(tmp, exec.Command("sh", "-c", "echo BenchmarkX 1 1 ns/op; exec sleep 60"), false)
+	if !writeAborted {
+		t.Errorf("a failed write with -write-errors=abort did not abort")
+	}
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("runBinary waited %v for the benchmark to finish after aborting", d)
+	}
+	b := &Benchmark{Name: "json"}
+	if s, _ := config.runBench(b, exec.Command("sh", "-c", "exit 1"), "", ""); s != "" {
+		t.Errorf("runBench ran a benchmark after aborting: %s", s)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/cpu"
+)
+
+// goamd64Features lists the CPU features each GOAMD64 level adds to the previous one,
+// to the extent that golang.org/x/sys/cpu can detect them.
+var goamd64Features = []struct {
+	level    string
+	features []string
+}{
+	{"v1", nil},
+	{"v2", []string{"cx16", "popcnt", "sse3", "sse4.1", "sse4.2", "ssse3"}},
+	{"v3", []string{"avx", "avx2", "bmi1", "bmi2", "fma", "osxsave"}},
+	{"v4", []string{"avx512f", "avx512bw", "avx512cd", "avx512dq", "avx512vl"}},
+}
+
+// hostCPUFeatures returns the CPU features of this machine, by name.
+func hostCPUFeatures() map[string]bool {
+	switch runtime.GOARCH {
+	case "amd64", "386":
+		return map[string]bool{
+			"adx":       cpu.X86.HasADX,
+			"aes":       cpu.X86.HasAES,
+			"avx":       cpu.X86.HasAVX,
+			"avx2":      cpu.X86.HasAVX2,
+			"avx512f":   cpu.X86.HasAVX512F,
+			"avx512bw":  cpu.X86.HasAVX512BW,
+			"avx512cd":  cpu.X86.HasAVX512CD,
+			"avx512dq":  cpu.X86.HasAVX512DQ,
+			"avx512vl":  cpu.X86.HasAVX512VL,
+			"bmi1":      cpu.X86.HasBMI1,
+			"bmi2":      cpu.X86.HasBMI2,
+			"cx16":      cpu.X86.HasCX16,
+			"erms":      cpu.X86.HasERMS,
+			"fma":       cpu.X86.HasFMA,
+			"osxsave":   cpu.X86.HasOSXSAVE,
+			"pclmulqdq": cpu.X86.HasPCLMULQDQ,
+			"popcnt":    cpu.X86.HasPOPCNT,
+			"rdrand":    cpu.X86.HasRDRAND,
+			"rdseed":    cpu.X86.HasRDSEED,
+			"sse2":      cpu.X86.HasSSE2,
+			"sse3":      cpu.X86.HasSSE3,
+			"sse4.1":    cpu.X86.HasSSE41,
+			"sse4.2":    cpu.X86.HasSSE42,
+			"ssse3":     cpu.X86.HasSSSE3,
+		}
+	case "arm64":
+		return map[string]bool{
+			"aes":     cpu.ARM64.HasAES,
+			"asimd":   cpu.ARM64.HasASIMD,
+			"atomics": cpu.ARM64.HasATOMICS,
+			"crc32":   cpu.ARM64.HasCRC32,
+			"pmull":   cpu.ARM64.HasPMULL,
+			"sha1":    cpu.ARM64.HasSHA1,
+			"sha2":    cpu.ARM64.HasSHA2,
+			"sha3":    cpu.ARM64.HasSHA3,
+			"sha512":  cpu.ARM64.HasSHA512,
+			"sve":     cpu.ARM64.HasSVE,
+		}
+	}
+	return nil
+}
+
+// requiredCPUFeatures returns the CPU features needed to run c's binary for b,
+// both those listed in CPUFeatures and those implied by GOAMD64, or nil if
+// the binary is not built for this machine's architecture. As when building,
+// c's GcEnv takes precedence over b's. If b is nil, only c's GcEnv applies.
+func (c *Configuration) requiredCPUFeatures(b *Benchmark) []string {
+	env := defaultEnv
+	if b != nil {
+		env = replaceEnvs(env, b.GcEnv)
+	}
+	env = replaceEnvs(env, c.GcEnv)
+	if goarch := getenv(env, "GOARCH"); goarch != "" && goarch != runtime.GOARCH {
+		return nil
+	}
+	features := append([]string(nil), c.CPUFeatures...)
+	if runtime.GOARCH == "amd64" {
+		level := getenv(env, "GOAMD64")
+		for _, l := range goamd64Features {
+			if l.level > level {
+				break
+			}
+			features = append(features, l.features...)
+		}
+	}
+	return features
+}
+
+// missingCPUFeatures returns the CPU features needed to run c's binary for b
+// (or, if b is nil, all of c's binaries) that this machine lacks (or that
+// bent does not know how to detect).
+func (c *Configuration) missingCPUFeatures(b *Benchmark) []string {
+	host := hostCPUFeatures()
+	seen := make(map[string]bool)
+	var missing []string
+	for _, f := range c.requiredCPUFeatures(b) {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		if has, known := host[f]; !known {
+			missing = append(missing, f+" (unknown)")
+		} else if !has {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && linux
+// +build go1.16,linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const raplDir = "/sys/class/powercap"
+
+// raplZone is a reading of one RAPL package energy counter, in microjoules.
+type raplZone struct {
+	name      string
+	energy    uint64
+	energyMax uint64 // the counter ranges from zero to this value, inclusive, then wraps around
+}
+
+// energySample is a reading of all the RAPL package energy counters.
+type energySample []raplZone
+
+// readEnergy reads the RAPL energy counters for each package (socket).
+// Subzones (core, uncore, dram) are contained in their package, and the
+// psys zone contains everything, so counting those would double-count.
+func readEnergy() (energySample, error) {
+	zones, err := filepath.Glob(path.Join(raplDir, "intel-rapl:*"))
+	if err != nil {
+		return nil, err
+	}
+	var sample energySample
+	for _, z := range zones {
+		if strings.Count(path.Base(z), ":") != 1 {
+			continue // a subzone
+		}
+		name, err := ioutil.ReadFile(path.Join(z, "name"))
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(string(name), "package") {
+			continue
+		}
+		energy, err := readUint(path.Join(z, "energy_uj"))
+		if err != nil {
+			return nil, err
+		}
+		energyMax, err := readUint(path.Join(z, "max_energy_range_uj"))
+		if err != nil {
+			return nil, err
+		}
+		sample = append(sample, raplZone{name: path.Base(z), energy: energy, energyMax: energyMax})
+	}
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("no RAPL package zones found in %s", raplDir)
+	}
+	return sample, nil
+}
+
+func readUint(file string) (uint64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// joulesSince returns the energy consumed between start and e,
+// allowing for each counter wrapping around (at most once).
+func (e energySample) joulesSince(start energySample) float64 {
+	var uj uint64
+	for i, z := range e {
+		if i >= len(start) || start[i].name != z.name {
+			break
+		}
+		if z.energy >= start[i].energy {
+			uj += z.energy - start[i].energy
+		} else {
+			uj += z.energyMax - start[i].energy + z.energy + 1
+		}
+	}
+	return float64(uj) / 1e6
+}
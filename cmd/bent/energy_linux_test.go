@@ -0,0 +1,26 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && linux
+// +build go1.16,linux
+
+package main
+
+import (
+	"testing"
+)
+
+func TestJoulesSince(t *testing.T) {
+	start := energySample{
+		{name: "intel-rapl:0", energy: 1000000, energyMax: 10000000},
+		{name: "intel-rapl:1", energy: 9500000, energyMax: 10000000},
+	}
+	end := energySample{
+		{name: "intel-rapl:0", energy: 3000000, energyMax: 10000000},
+		{name: "intel-rapl:1", energy: 500000, energyMax: 10000000}, // wrapped
+	}
+	if got, want := end.joulesSince(start), 3.000001; got != want {
+		t.Errorf("joulesSince = %v, want %v", got, want)
+	}
+}
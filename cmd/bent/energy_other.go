@@ -0,0 +1,21 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && !linux
+// +build go1.16,!linux
+
+package main
+
+import "errors"
+
+type energySample struct{}
+
+// readEnergy is only implemented for Linux.
+func readEnergy() (energySample, error) {
+	return energySample{}, errors.New("energy measurement requires Linux RAPL counters")
+}
+
+func (e energySample) joulesSince(start energySample) float64 {
+	return 0
+}
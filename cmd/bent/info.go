@@ -0,0 +1,126 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// countRun records that b ran (successfully, if ok) for c.
+func (c *Configuration) countRun(b *Benchmark, ok bool) {
+	if c.runCounts == nil {
+		c.runCounts = make(map[string]*runCount)
+	}
+	rc := c.runCounts[b.Name]
+	if rc == nil {
+		rc = &runCount{}
+		c.runCounts[b.Name] = rc
+	}
+	if ok {
+		rc.ok++
+	} else {
+		rc.failed++
+	}
+}
+
+// toolchainVersion returns the output of "go version" for c's toolchain.
+func (c *Configuration) toolchainVersion() string {
+	cmd := exec.Command(c.goCommand(), "version")
+	cmd.Env = defaultEnv
+	if c.Root != "" {
+		cmd.Env = replaceEnv(cmd.Env, "GOROOT", c.Root)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeInfo writes <runstamp>.<config>.info.txt, a description, for people,
+// of how c's results were obtained and what they include.
+func (c *Configuration) writeInfo(todo *Todo) {
+	buf := new(bytes.Buffer)
+	line := func(key string, value interface{}) {
+		fmt.Fprintf(buf, "  %-12s %v\n", key+":", value)
+	}
+	list := func(key string, values []string) {
+		if len(values) > 0 {
+			line(key, strings.Join(values, " "))
+		}
+	}
+
+	fmt.Fprintf(buf, "Configuration %s, run %s\n", c.Name, runstamp)
+	if quick {
+		fmt.Fprintf(buf, "Quick (-quick) smoke test: one run, no AfterBuild or profiling; not suitable for comparisons\n")
+	}
+	fmt.Fprintf(buf, "Command line: %s\n", strings.Join(maskSecrets(os.Args), " "))
+	fmt.Fprintf(buf, "Host: %s/%s\n", getenv(defaultEnv, "GOOS"), getenv(defaultEnv, "GOARCH"))
+
+	fmt.Fprintf(buf, "\nToolchain:\n")
+	line("Version", c.toolchainVersion())
+	if c.Root != "" {
+		line("Root", c.Root)
+	}
+	goos, goarch := c.buildTarget()
+	line("Target", goos+"/"+goarch)
+
+	fmt.Fprintf(buf, "\nBuild:\n")
+	if c.GcFlags != "" {
+		line("GcFlags", c.GcFlags)
+	}
+	list("BuildFlags", c.BuildFlags)
+	list("GcEnv", c.GcEnv)
+	list("AfterBuild", c.AfterBuild)
+	if c.buildsFrom != "" {
+		line("Binaries", "shared with configuration "+c.buildsFrom)
+	}
+	if runContainer != "" {
+		line("Binaries", "from an earlier bent invocation (-r)")
+	}
+
+	fmt.Fprintf(buf, "\nRun:\n")
+	list("RunFlags", c.RunFlags)
+	list("RunEnv", maskSecrets(c.RunEnv))
+	list("RunWrapper", c.RunWrapper)
+	if c.RunContainer != "" {
+		line("Container", c.RunContainer+" (image "+c.runContainerID+", run with "+containerEngine+")")
+	}
+	list("CPUFeatures", c.CPUFeatures)
+	line("Repetitions", N)
+	line("Interleaved", interleave)
+	line("Sandboxed", requireSandbox)
+	line("Energy", energy)
+
+	fmt.Fprintf(buf, "\nBenchmarks:\n")
+	for i := range todo.Benchmarks {
+		b := &todo.Benchmarks[i]
+		rc := c.runCounts[b.Name]
+		if rc == nil {
+			continue
+		}
+		fmt.Fprintf(buf, "  %s (%s%s): %d runs", b.Name, b.Repo, b.Version, rc.ok)
+		if rc.failed > 0 {
+			fmt.Fprintf(buf, ", %d failed", rc.failed)
+		}
+		if len(b.PageCache) > 0 {
+			fmt.Fprintf(buf, ", page cache %s", strings.Join(b.PageCache, " and "))
+		}
+		fmt.Fprintln(buf)
+	}
+
+	file := c.thingBenchName("info.txt")
+	if err := ioutil.WriteFile(file, buf.Bytes(), 0664); err != nil {
+		fmt.Printf("There was an error writing %s, error %v\n", file, err)
+	}
+}
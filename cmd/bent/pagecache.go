@@ -0,0 +1,97 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Values for Benchmark.PageCache.
+const (
+	pageCacheCold = "cold" // drop the page cache before running
+	pageCacheWarm = "warm" // read the benchmark's CacheFiles before running
+)
+
+// preparePageCache puts the page cache into state cache for a run of b.
+func preparePageCache(cache string, b *Benchmark) error {
+	switch cache {
+	case pageCacheCold:
+		if verbose > 0 {
+			fmt.Println("# dropping page cache")
+		}
+		return dropPageCache()
+	case pageCacheWarm:
+		for _, f := range b.CacheFiles {
+			if err := warmPageCache(path.Join(b.RunDir, f)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkPageCache drops the page cache once up front if any enabled benchmark
+// runs with a cold page cache, to learn whether that is possible here.
+// If it is not, it warns, and those benchmarks skip their cold runs.
+func checkPageCache(todo *Todo) {
+	var cold []*Benchmark
+	for i := range todo.Benchmarks {
+		b := &todo.Benchmarks[i]
+		if b.Disabled {
+			continue
+		}
+		for _, cache := range b.PageCache {
+			if cache == pageCacheCold {
+				cold = append(cold, b)
+				break
+			}
+		}
+	}
+	if len(cold) == 0 {
+		return
+	}
+	err := dropPageCache()
+	if err == nil {
+		return
+	}
+	fmt.Printf("Warning: skipping %s page cache runs, %v\n", pageCacheCold, err)
+	for _, b := range cold {
+		var caches []string
+		for _, cache := range b.PageCache {
+			if cache != pageCacheCold {
+				caches = append(caches, cache)
+			}
+		}
+		b.PageCache = caches
+	}
+}
+
+// warmPageCache reads file, or if it is a directory, all the files in it,
+// so that the pages are in the page cache.
+func warmPageCache(file string) error {
+	if verbose > 0 {
+		fmt.Printf("# reading %s into page cache\n", file)
+	}
+	return filepath.WalkDir(file, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(io.Discard, f)
+		return err
+	})
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && linux
+// +build go1.16,linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"syscall"
+)
+
+// dropPageCache writes out dirty pages and then empties the page cache.
+// This requires root.
+func dropPageCache() error {
+	syscall.Sync()
+	if err := ioutil.WriteFile("/proc/sys/vm/drop_caches", []byte("3\n"), 0644); err != nil {
+		return fmt.Errorf("could not drop page cache (requires root): %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16 && !linux
+// +build go1.16,!linux
+
+package main
+
+import "errors"
+
+// dropPageCache is only implemented for Linux.
+func dropPageCache() error {
+	return errors.New("dropping the page cache is only implemented for Linux")
+}
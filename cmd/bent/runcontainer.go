@@ -0,0 +1,67 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// containerEngine is the command used to run binaries in a configuration's RunContainer.
+var containerEngine string
+
+// findContainerEngine sets containerEngine to docker or, failing that, podman.
+func findContainerEngine() error {
+	if containerEngine != "" {
+		return nil
+	}
+	for _, e := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(e); err == nil {
+			containerEngine = e
+			return nil
+		}
+	}
+	return errors.New("running in a container requires the docker or podman command")
+}
+
+// inspectRunContainer obtains (pulling it if necessary) c's RunContainer image,
+// and records its digest so that the results say exactly what they ran in.
+// An image that did not come from a registry has no digest, so its ID is used instead.
+func (c *Configuration) inspectRunContainer() error {
+	if err := findContainerEngine(); err != nil {
+		return err
+	}
+	inspect := func() (string, error) {
+		cmd := exec.Command(containerEngine, "image", "inspect", "--format", "{{if .RepoDigests}}{{index .RepoDigests 0}}{{else}}{{.Id}}{{end}}", c.RunContainer)
+		if verbose > 0 {
+			fmt.Println(asCommandLine(dirs.wd, cmd))
+		}
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	id, err := inspect()
+	if err != nil {
+		cmd := exec.Command(containerEngine, "pull", c.RunContainer)
+		if verbose > 0 {
+			fmt.Println(asCommandLine(dirs.wd, cmd))
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s pull failed: %v\n%s", containerEngine, err, out)
+		}
+		if id, err = inspect(); err != nil {
+			return fmt.Errorf("%s image inspect failed: %v", containerEngine, err)
+		}
+	}
+	c.runContainerID = id
+	if verbose > 0 {
+		fmt.Printf("Configuration %s runs in %s, image %s\n", c.Name, c.RunContainer, id)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// resultRange is the smallest and largest values seen for one benchmark and unit.
+type resultRange struct {
+	min, max float64
+}
+
+// isTimeUnit reports whether unit measures time, so that a value of zero is implausible.
+func isTimeUnit(unit string) bool {
+	return strings.HasSuffix(unit, "ns/op") || strings.HasSuffix(unit, "sec/op")
+}
+
+// suspiciousResults returns descriptions of the implausible result lines in out,
+// which is in the benchmark format: times of zero, negative values of any unit,
+// and, if ratio > 0, values that differ by more than a factor of ratio between
+// runs of the same benchmark. Results from different benchmarks (shortname)
+// or page cache states are not compared with each other.
+func suspiciousResults(out []byte, ratio float64) []string {
+	var s []string
+	shortname, pagecache := "", ""
+	ranges := make(map[string]*resultRange)
+	var keys []string // in order of appearance
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "shortname:") {
+			shortname = strings.TrimSpace(strings.TrimPrefix(line, "shortname:"))
+			pagecache = ""
+			continue
+		}
+		if strings.HasPrefix(line, "pagecache:") {
+			pagecache = strings.TrimSpace(strings.TrimPrefix(line, "pagecache:"))
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue // Not a result line
+		}
+		name := fields[0]
+		if shortname != "" {
+			name += " (" + shortname
+			if pagecache != "" {
+				name += ", " + pagecache
+			}
+			name += ")"
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			unit := fields[i+1]
+			if v < 0 || v == 0 && isTimeUnit(unit) {
+				s = append(s, fmt.Sprintf("%s reported %s %s", name, fields[i], unit))
+				continue
+			}
+			if v == 0 {
+				continue // Zero allocations, etc., are fine, and cannot be compared as a ratio.
+			}
+			key := name + " " + unit
+			r := ranges[key]
+			if r == nil {
+				ranges[key] = &resultRange{min: v, max: v}
+				keys = append(keys, key)
+				continue
+			}
+			if v < r.min {
+				r.min = v
+			}
+			if v > r.max {
+				r.max = v
+			}
+		}
+	}
+
+	if ratio > 0 {
+		for _, key := range keys {
+			if r := ranges[key]; r.max > ratio*r.min {
+				s = append(s, fmt.Sprintf("%s varied from %g to %g, more than a factor of %g", key, r.min, r.max, ratio))
+			}
+		}
+	}
+	return s
+}
+
+// checkResults returns descriptions of the suspicious results in c's benchmark output.
+func (c *Configuration) checkResults(ratio float64) []string {
+	out, err := ioutil.ReadFile(c.thingBenchName("stdout"))
+	if err != nil {
+		fmt.Printf("There was an error reading %s to check the results, error %v\n", c.thingBenchName("stdout"), err)
+		return nil
+	}
+	var s []string
+	for _, r := range suspiciousResults(out, ratio) {
+		s = append(s, c.Name+": "+r)
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const suspiciousStdout = `goos: linux
+shortname: fine
+BenchmarkFine-8 	 1000	 100 ns/op	 0 B/op	 0 allocs/op
+BenchmarkFine-8 	 1000	 120 ns/op	 0 B/op	 0 allocs/op
+shortname: broken
+BenchmarkBroken-8 	 1000000000	 0 ns/op
+BenchmarkBroken-8 	 1000	 -5 MB/s
+shortname: noisy
+pagecache: cold
+BenchmarkNoisy-8 	 10	 5000 ns/op
+pagecache: warm
+BenchmarkNoisy-8 	 10	 50 ns/op
+BenchmarkNoisy-8 	 10	 4000 ns/op
+PASS
+`
+
+func TestSuspiciousResults(t *testing.T) {
+	got := suspiciousResults([]byte(suspiciousStdout), 10)
+	want := []string{
+		"BenchmarkBroken-8 (broken) reported 0 ns/op",
+		"BenchmarkBroken-8 (broken) reported -5 MB/s",
+		"BenchmarkNoisy-8 (noisy, warm) ns/op varied from 50 to 4000, more than a factor of 10",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suspiciousResults(ratio 10):\ngot  %q\nwant %q", got, want)
+	}
+
+	got = suspiciousResults([]byte(suspiciousStdout), 0)
+	if !reflect.DeepEqual(got, want[:2]) {
+		t.Errorf("suspiciousResults(ratio 0):\ngot  %q\nwant %q", got, want[:2])
+	}
+}
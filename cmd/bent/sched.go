@@ -0,0 +1,220 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+func (c *Configuration) schedBenchName() string {
+	return c.thingBenchName("sched")
+}
+
+// traceFile returns the name of the execution trace file for run i of binary testBinaryName.
+func (c *Configuration) traceFile(testBinaryName string, i int, cache string) string {
+	name := fmt.Sprintf("%s_%d", testBinaryName, i)
+	if cache != "" {
+		name += "_" + cache
+	}
+	return path.Join(dirs.wd, c.thingBenchName("traces"), name+".trace")
+}
+
+// createSchedFiles creates the directory for c's execution traces
+// and the file to which recordSchedLatency appends.
+func (c *Configuration) createSchedFiles() {
+	if err := mkdirAsNeeded(c.thingBenchName("traces")); err != nil {
+		fmt.Println(err)
+		return
+	}
+	f, err := os.Create(c.schedBenchName())
+	if err != nil {
+		fmt.Println("Error creating scheduler latency benchmark file ", c.schedBenchName(), ", err=", err)
+		return
+	}
+	header := metadataLine("goos", runtime.GOOS) + metadataLine("goarch", runtime.GOARCH)
+	for _, unit := range []string{"sched-latency-ns/op", "sched-waits/op", "sched-latency-mean-ns/op",
+		"sched-latency-p50-ns/op", "sched-latency-p99-ns/op", "sched-latency-max-ns/op"} {
+		header += unitLine(unit, "assume=nothing")
+	}
+	c.writeHeader(f, header)
+	f.Close() // will be appending later
+}
+
+// schedStats summarizes the times that goroutines spent runnable but not running.
+type schedStats struct {
+	totalNs, waits      int64
+	p50Ns, p99Ns, maxNs int64
+	havePercentiles     bool // false if only the totals are known
+}
+
+// schedLatency returns the statistics of the time goroutines spent runnable
+// but not running in the execution trace in traceFile.
+// It reads the trace with the configuration's own "go tool trace", since the
+// trace format can change from one Go version to the next; toolchains that
+// cannot print the trace's events (before Go 1.22) provide only the scheduler
+// latency profile, which aggregates latencies by stack, so that only the totals are known.
+func (c *Configuration) schedLatency(traceFile string) (schedStats, error) {
+	tool := func(arg string) *exec.Cmd {
+		cmd := exec.Command(c.goCommand(), "tool", "trace", arg, traceFile)
+		cmd.Env = defaultEnv
+		if c.Root != "" {
+			cmd.Env = replaceEnv(cmd.Env, "GOROOT", c.Root)
+		}
+		if verbose > 0 {
+			fmt.Println(asCommandLine(dirs.wd, cmd))
+		}
+		return cmd
+	}
+
+	cmd := tool("-d=parsed")
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err == nil {
+		waits := schedWaits(stdout)
+		if err = cmd.Wait(); err == nil {
+			return schedStatsOf(waits), nil
+		}
+	}
+
+	cmd = tool("-pprof=sched")
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return schedStats{}, fmt.Errorf("%v, stderr = %s", err, stderr)
+	}
+	totalNs, waits, err := schedLatencyFromProfile(out)
+	return schedStats{totalNs: totalNs, waits: waits}, err
+}
+
+// goTransition matches a goroutine state transition printed by "go tool trace -d=parsed".
+var goTransition = regexp.MustCompile(`StateTransition Time=(\d+) .*\bGoID=(\d+) (\w+)->(\w+)`)
+
+// schedWaits returns the durations, in nanoseconds, of each time a goroutine
+// went from runnable to running, in the events read from r, the output of
+// "go tool trace -d=parsed". Like the scheduler latency profile, it does not
+// count the wait of a new goroutine to run for the first time.
+func schedWaits(r io.Reader) []int64 {
+	var waits []int64
+	runnable := make(map[string]int64) // goroutine ID to time it became runnable
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		m := goTransition.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		t, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		g, from, to := m[2], m[3], m[4]
+		switch {
+		case to == "Runnable" && from != "NotExist":
+			runnable[g] = t
+		case from == "Runnable":
+			if start, ok := runnable[g]; ok {
+				if to == "Running" {
+					waits = append(waits, t-start)
+				}
+				delete(runnable, g)
+			}
+		}
+	}
+	return waits
+}
+
+// schedStatsOf returns the statistics of waits, in nanoseconds.
+func schedStatsOf(waits []int64) schedStats {
+	st := schedStats{waits: int64(len(waits)), havePercentiles: true}
+	if len(waits) == 0 {
+		return st
+	}
+	sorted := append([]int64(nil), waits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, w := range sorted {
+		st.totalNs += w
+	}
+	// Nearest-rank percentiles.
+	rank := func(p float64) int64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	st.p50Ns, st.p99Ns, st.maxNs = rank(0.50), rank(0.99), sorted[len(sorted)-1]
+	return st
+}
+
+// schedLatencyFromProfile sums the samples of a scheduler latency profile
+// as written by "go tool trace -pprof=sched".
+func schedLatencyFromProfile(b []byte) (totalNs, waits int64, err error) {
+	p, err := profile.Parse(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, err
+	}
+	countIndex, delayIndex := -1, -1
+	for i, st := range p.SampleType {
+		switch {
+		case st.Unit == "count":
+			countIndex = i
+		case st.Unit == "nanoseconds":
+			delayIndex = i
+		}
+	}
+	if countIndex < 0 || delayIndex < 0 {
+		return 0, 0, fmt.Errorf("unexpected sample types in scheduler latency profile")
+	}
+	for _, s := range p.Sample {
+		waits += s.Value[countIndex]
+		totalNs += s.Value[delayIndex]
+	}
+	return totalNs, waits, nil
+}
+
+// recordSchedLatency appends the scheduler latency in traceFile, from a run of b, to c's sched file.
+func (c *Configuration) recordSchedLatency(b *Benchmark, traceFile string) {
+	st, err := c.schedLatency(traceFile)
+	if err != nil {
+		fmt.Printf("Error obtaining scheduler latency from %s, %v\n", traceFile, err)
+		return
+	}
+	mean := int64(0)
+	if st.waits > 0 {
+		mean = st.totalNs / st.waits
+	}
+	s := fmt.Sprintf("Benchmark%s 1 %d sched-latency-ns/op %d sched-waits/op %d sched-latency-mean-ns/op",
+		strings.Title(b.Name), st.totalNs, st.waits, mean)
+	if st.havePercentiles {
+		s += fmt.Sprintf(" %d sched-latency-p50-ns/op %d sched-latency-p99-ns/op %d sched-latency-max-ns/op", st.p50Ns, st.p99Ns, st.maxNs)
+	}
+	s += "\n"
+	if verbose > 0 {
+		fmt.Print(s)
+	}
+	f, err := os.OpenFile(c.schedBenchName(), os.O_WRONLY|os.O_APPEND, os.ModePerm)
+	if err != nil {
+		fmt.Printf("There was an error opening %s for append, error %v\n", c.schedBenchName(), err)
+		return
+	}
+	c.writeOutput(f, []byte(s))
+	f.Close()
+}
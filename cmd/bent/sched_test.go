@@ -0,0 +1,84 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+const sampleEvents = `M=-1 P=-1 G=-1 Sync Time=100 N=1 Trace=100 Mono=100 Wall=2021-10-14T07:07:40.047148052Z
+M=1 P=0 G=1 StateTransition Time=1000 GoID=7 NotExist->Runnable Reason=""
+M=1 P=0 G=-1 StateTransition Time=1500 GoID=7 Runnable->Running Reason=""
+M=1 P=0 G=7 StateTransition Time=2000 GoID=7 Running->Waiting Reason="chan receive"
+M=1 P=0 G=1 StateTransition Time=3000 GoID=7 Waiting->Runnable Reason=""
+M=1 P=0 G=-1 StateTransition Time=3400 GoID=7 Runnable->Running Reason=""
+M=1 P=0 G=1 StateTransition Time=4000 GoID=1 Running->Runnable Reason="preempted"
+Stack=
+	runtime.Gosched @ 0x4757c3
+M=1 P=0 G=-1 StateTransition Time=4100 ProcID=0 Running->Idle Reason=""
+M=1 P=0 G=-1 StateTransition Time=5000 GoID=1 Runnable->Running Reason=""
+M=1 P=0 G=1 StateTransition Time=6000 GoID=9 Waiting->Runnable Reason=""
+`
+
+func TestSchedWaits(t *testing.T) {
+	// Goroutine 7's first run follows its creation, and goroutine 9 never runs.
+	got := schedWaits(strings.NewReader(sampleEvents))
+	if want := []int64{400, 1000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("schedWaits = %v, want %v", got, want)
+	}
+}
+
+func TestSchedStatsOf(t *testing.T) {
+	var waits []int64
+	for i := int64(100); i > 0; i-- {
+		waits = append(waits, i*10)
+	}
+	got := schedStatsOf(waits)
+	want := schedStats{totalNs: 50500, waits: 100, p50Ns: 500, p99Ns: 990, maxNs: 1000, havePercentiles: true}
+	if got != want {
+		t.Errorf("schedStatsOf = %+v, want %+v", got, want)
+	}
+	if got, want := schedStatsOf(nil), (schedStats{havePercentiles: true}); got != want {
+		t.Errorf("schedStatsOf(nil) = %+v, want %+v", got, want)
+	}
+}
+
+func TestSchedLatencyFromProfile(t *testing.T) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "contentions", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Value: []int64{3, 1200}},
+			{Value: []int64{2, 800}},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	totalNs, waits, err := schedLatencyFromProfile(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totalNs != 2000 || waits != 5 {
+		t.Errorf("schedLatencyFromProfile = %d ns, %d waits, want 2000 ns, 5 waits", totalNs, waits)
+	}
+
+	p.SampleType[1].Unit = "bytes"
+	buf.Reset()
+	if err := p.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := schedLatencyFromProfile(buf.Bytes()); err == nil {
+		t.Errorf("schedLatencyFromProfile accepted a profile without a delay")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"time"
+)
+
+// timingsFile, in the working directory, accumulates the build and run times
+// of each benchmark and configuration pair across bent invocations.
+const timingsFile = "timings.json"
+
+// timing is the accumulated build and run times for one benchmark binary.
+type timing struct {
+	Builds, Runs       int
+	BuildTime, RunTime time.Duration // totals
+}
+
+func (t *timing) meanBuild() time.Duration {
+	return t.BuildTime / time.Duration(t.Builds)
+}
+
+func (t *timing) meanRun() time.Duration {
+	return t.RunTime / time.Duration(t.Runs)
+}
+
+// timings maps a benchmark binary name (see benchName) to its timing.
+type timings map[string]*timing
+
+// history holds the timings read at startup plus those from this invocation.
+var history = make(timings)
+
+func (ts timings) get(name string) *timing {
+	t := ts[name]
+	if t == nil {
+		t = &timing{}
+		ts[name] = t
+	}
+	return t
+}
+
+func (ts timings) recordBuild(name string, d time.Duration) {
+	t := ts.get(name)
+	t.Builds++
+	t.BuildTime += d
+}
+
+func (ts timings) recordRun(name string, d time.Duration) {
+	t := ts.get(name)
+	t.Runs++
+	t.RunTime += d
+}
+
+// loadTimings reads timingsFile, if it exists, into history.
+func loadTimings() {
+	b, err := ioutil.ReadFile(path.Join(dirs.wd, timingsFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("There was an error reading %s, error %v\n", timingsFile, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(b, &history); err != nil {
+		fmt.Printf("There was an error unmarshalling %s, error %v\n", timingsFile, err)
+	}
+}
+
+// saveTimings writes history to timingsFile.
+func saveTimings() {
+	b, err := json.MarshalIndent(history, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(dirs.wd, timingsFile), b, 0664)
+	}
+	if err != nil {
+		fmt.Printf("There was an error writing %s, error %v\n", timingsFile, err)
+	}
+}
+
+// estimateTime returns the expected duration of count builds (or runs)
+// of a benchmark for a configuration, according to history.  Lacking history
+// for that pair, it uses the mean over the benchmark's other configurations.
+// The boolean result is false if there is no history for the benchmark at all.
+func estimateTime(todo *Todo, b *Benchmark, c *Configuration, count int, build bool) (time.Duration, bool) {
+	mean := func(t *timing) (time.Duration, bool) {
+		if build && t.Builds > 0 {
+			return t.meanBuild(), true
+		}
+		if !build && t.Runs > 0 {
+			return t.meanRun(), true
+		}
+		return 0, false
+	}
+	if t := history[c.benchName(b)]; t != nil {
+		if d, ok := mean(t); ok {
+			return d * time.Duration(count), true
+		}
+	}
+	var total time.Duration
+	n := 0
+	for i := range todo.Configurations {
+		if t := history[todo.Configurations[i].benchName(b)]; t != nil {
+			if d, ok := mean(t); ok {
+				total += d
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return total / time.Duration(n) * time.Duration(count), true
+}
+
+// estimateTotals is the expected time and number of builds and runs, and
+// how many of those have no history to go on.
+type estimateTotals struct {
+	buildTime, runTime         time.Duration
+	builds, runs               int
+	buildsUnknown, runsUnknown int
+}
+
+// estimateAll returns how long building and running todo's enabled benchmark
+// and configuration pairs ought to take, not counting getting benchmarks
+// and building toolchains.
+func estimateAll(todo *Todo, buildCount int) estimateTotals {
+	var e estimateTotals
+	for bi := range todo.Benchmarks {
+		b := &todo.Benchmarks[bi]
+		if b.Disabled {
+			continue
+		}
+		runCount := N
+		if len(b.PageCache) > 0 {
+			runCount *= len(b.PageCache)
+		}
+		for ci := range todo.Configurations {
+			c := &todo.Configurations[ci]
+			if c.Disabled {
+				continue
+			}
+			if runContainer == "" && c.buildsFrom == "" {
+				e.builds += buildCount
+				if d, ok := estimateTime(todo, b, c, buildCount, true); ok {
+					e.buildTime += d
+				} else {
+					e.buildsUnknown += buildCount
+				}
+			}
+			e.runs += runCount
+			if d, ok := estimateTime(todo, b, c, runCount, false); ok {
+				e.runTime += d
+			} else {
+				e.runsUnknown += runCount
+			}
+		}
+	}
+	return e
+}
+
+// printEstimate prints the estimate for building and running todo.
+func printEstimate(todo *Todo, buildCount int) {
+	e := estimateAll(todo, buildCount)
+	round := func(d time.Duration) time.Duration { return d.Round(time.Second) }
+	fmt.Printf("Estimated build time: %v for %d builds (%d with no history)\n", round(e.buildTime), e.builds, e.buildsUnknown)
+	fmt.Printf("Estimated run time:   %v for %d runs (%d with no history)\n", round(e.runTime), e.runs, e.runsUnknown)
+	fmt.Printf("Estimated total time: %v, not including getting benchmarks and building toolchains\n", round(e.buildTime+e.runTime))
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateTime(t *testing.T) {
+	defer func(h timings) { history = h }(history)
+	history = timings{
+		"json_A":  {Builds: 2, BuildTime: 20 * time.Second, Runs: 4, RunTime: 8 * time.Second},
+		"json_B":  {Builds: 1, BuildTime: 30 * time.Second, Runs: 1, RunTime: 4 * time.Second},
+		"regex_A": {Builds: 1, BuildTime: 5 * time.Second}, // never ran
+	}
+	todo := &Todo{
+		Benchmarks:     []Benchmark{{Name: "json"}, {Name: "regex"}, {Name: "crypto"}},
+		Configurations: []Configuration{{Name: "A"}, {Name: "B"}, {Name: "C"}},
+	}
+	json, regex, crypto := &todo.Benchmarks[0], &todo.Benchmarks[1], &todo.Benchmarks[2]
+	a, c := &todo.Configurations[0], &todo.Configurations[2]
+
+	tests := []struct {
+		name   string
+		b      *Benchmark
+		c      *Configuration
+		count  int
+		build  bool
+		want   time.Duration
+		wantOk bool
+	}{
+		{"exact build", json, a, 3, true, 30 * time.Second, true},
+		{"exact run", json, a, 3, false, 6 * time.Second, true},
+		{"other configurations build", json, c, 1, true, 20 * time.Second, true}, // mean of 10s and 30s
+		{"other configurations run", json, c, 2, false, 6 * time.Second, true},   // mean of 2s and 4s
+		{"builds but no runs", regex, a, 1, false, 0, false},
+		{"no history", crypto, a, 1, true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := estimateTime(todo, tt.b, tt.c, tt.count, tt.build)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: estimateTime = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestEstimateAll(t *testing.T) {
+	defer func(h timings, n int) { history, N = h, n }(history, N)
+	history = timings{
+		"json_A": {Builds: 1, BuildTime: 10 * time.Second, Runs: 1, RunTime: 2 * time.Second},
+	}
+	N = 5
+
+	tests := []struct {
+		name string
+		todo *Todo
+		want estimateTotals
+	}{
+		{
+			"history",
+			&Todo{Benchmarks: []Benchmark{{Name: "json"}}, Configurations: []Configuration{{Name: "A"}}},
+			estimateTotals{buildTime: 10 * time.Second, runTime: 10 * time.Second, builds: 1, runs: 5},
+		},
+		{
+			"no history",
+			&Todo{Benchmarks: []Benchmark{{Name: "crypto"}}, Configurations: []Configuration{{Name: "A"}}},
+			estimateTotals{builds: 1, runs: 5, buildsUnknown: 1, runsUnknown: 5},
+		},
+		{
+			"page cache",
+			&Todo{Benchmarks: []Benchmark{{Name: "json", PageCache: []string{pageCacheCold, pageCacheWarm}}}, Configurations: []Configuration{{Name: "A"}}},
+			estimateTotals{buildTime: 10 * time.Second, runTime: 20 * time.Second, builds: 1, runs: 10},
+		},
+		{
+			"shared builds",
+			&Todo{Benchmarks: []Benchmark{{Name: "json"}}, Configurations: []Configuration{{Name: "A"}, {Name: "B", buildsFrom: "A"}}},
+			estimateTotals{buildTime: 10 * time.Second, runTime: 20 * time.Second, builds: 1, runs: 10},
+		},
+		{
+			"disabled",
+			&Todo{Benchmarks: []Benchmark{{Name: "json"}, {Name: "regex", Disabled: true}}, Configurations: []Configuration{{Name: "A"}, {Name: "B", Disabled: true}}},
+			estimateTotals{buildTime: 10 * time.Second, runTime: 10 * time.Second, builds: 1, runs: 5},
+		},
+	}
+	for _, tt := range tests {
+		if got := estimateAll(tt.todo, 1); got != tt.want {
+			t.Errorf("%s: estimateAll = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}